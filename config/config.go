@@ -13,17 +13,139 @@ type Config struct {
 	Port          int    `json:"port"`
 	StackfieldURL string `json:"stackfield_url"`
 	DBPath        string `json:"db"`
+	// Maximum number of attempts for a failed notification before it's
+	// dropped from the retry queue.
+	RetryMaxAttempts int `json:"retry_max_attempts"`
+	// Delay in seconds before the first retry. Doubles with each attempt.
+	RetryBaseDelay int `json:"retry_base_delay"`
+	// Number of workers processing notifications in the background.
+	Workers int `json:"workers"`
+	// Seconds to wait for running handlers when the daemon is shut down.
+	ShutdownTimeout int `json:"shutdown_timeout"`
+	// Seconds after which the cached list of shows is fetched again.
+	ShowRefreshInterval int `json:"show_refresh_interval"`
+	// Bearer token required for the modifying admin endpoints. These
+	// endpoints are disabled if no token is set.
+	AdminToken string `json:"admin_token"`
+	// Secret as configured in the Omnia Notification Gateway. Incoming
+	// notifications without a matching secret are rejected. Verification is
+	// disabled if empty.
+	NotificationSecret string `json:"notification_secret"`
+	// Language of the messages, de or en.
+	Locale string `json:"locale"`
+	// Custom templates for the messages. The built-in templates of the
+	// locale are used for all templates not given.
+	Templates TemplateConfig `json:"templates"`
+	// Handlers to run on incoming notifications.
+	Handlers []HandlerConfig `json:"handlers"`
+	// Targets for the messages of the daemon. A Stackfield notifier is added
+	// for stackfield_url if set.
+	Notifiers []NotifierConfig `json:"notifiers"`
+	// Rules deciding which notifiers receive a message. All notifiers
+	// receive all messages if no routes are configured.
+	Routes []RouteConfig `json:"routes"`
+	// Notifiers receiving the messages no route matches. Such messages are
+	// dropped if no fallback is configured.
+	FallbackNotifiers []string `json:"fallback_notifiers"`
 }
 
-// Loads a Config from a given file path.
+// Describes a target for messages. Which fields are needed depends on the
+// type.
+type NotifierConfig struct {
+	// Name used to refer to the notifier in routes. Defaults to the type,
+	// followed by the position in the list if the type is used multiple
+	// times.
+	Name string `json:"name,omitempty"`
+	// One of stackfield, slack, mattermost, teams, matrix or email.
+	Type string `json:"type"`
+	// Webhook URL for stackfield, slack, mattermost and teams.
+	URL string `json:"url,omitempty"`
+	// Homeserver base URL, room ID and access token of the bot account for
+	// matrix.
+	Homeserver  string `json:"homeserver,omitempty"`
+	RoomID      string `json:"room_id,omitempty"`
+	AccessToken string `json:"access_token,omitempty"`
+	// SMTP server and mail settings for email.
+	SMTPHost string   `json:"smtp_host,omitempty"`
+	SMTPPort int      `json:"smtp_port,omitempty"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from,omitempty"`
+	To       []string `json:"to,omitempty"`
+	Subject  string   `json:"subject,omitempty"`
+	// Delivery settings for stackfield. Defaults are used for values which
+	// are zero.
+	Stackfield StackfieldConfig `json:"stackfield"`
+}
+
+// Retries, rate limit and message splitting of a Stackfield notifier.
+type StackfieldConfig struct {
+	// Timeout of a single request in seconds.
+	Timeout int `json:"timeout,omitempty"`
+	// Maximum number of attempts on network errors, 5xx and 429 responses.
+	RetryMaxAttempts int `json:"retry_max_attempts,omitempty"`
+	// Delay in seconds before the first retry. Doubles with each attempt.
+	RetryBaseDelay int `json:"retry_base_delay,omitempty"`
+	// Maximum number of messages per minute.
+	RateLimit int `json:"rate_limit,omitempty"`
+	// Messages longer than this number of characters are split. Has to
+	// leave room for the part counter, the minimum is 17.
+	MaxLength int `json:"max_length,omitempty"`
+}
+
+// Returns all configured notifiers including the one for the legacy
+// stackfield_url option.
+func (c Config) AllNotifiers() []NotifierConfig {
+	rsl := append([]NotifierConfig{}, c.Notifiers...)
+	if c.StackfieldURL != "" {
+		rsl = append(rsl, NotifierConfig{Name: "stackfield", Type: "stackfield", URL: c.StackfieldURL})
+	}
+	return rsl
+}
+
+// Sends messages matching all given criteria to the listed notifiers. Empty
+// criteria match every message.
+type RouteConfig struct {
+	// IDs or titles of the matched show.
+	Shows []string `json:"shows,omitempty"`
+	// Producers as given by the uploader. Matches if the name is part of the
+	// producer field.
+	Producers []string `json:"producers,omitempty"`
+	// One of success (no errors and no manual tasks), error (at least one
+	// task failed) or manual (manual tasks are necessary).
+	Outcome string `json:"outcome,omitempty"`
+	// Names of the notifiers receiving the matching messages.
+	Notifiers []string `json:"notifiers"`
+}
+
+// Paths to the files of custom message templates. The templates use the
+// text/template syntax.
+type TemplateConfig struct {
+	// Report on a processed upload.
+	Report string `json:"report,omitempty"`
+	// Alert on uploads which were interrupted by a shutdown.
+	Stale string `json:"stale,omitempty"`
+}
+
+// Enables a notification handler and provides its settings.
+type HandlerConfig struct {
+	// Name under which the handler is registered.
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	// Handler specific settings. Omitted settings fall back to the defaults
+	// of the handler.
+	Settings json.RawMessage `json:"settings,omitempty"`
+}
+
+// Loads a Config from a given file path. Fields missing in the file fall back
+// to the values of [ConfigFromDefaults].
 func ConfigFromJSON(path string) (*Config, error) {
 	raw, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
-	var rsl Config
-	json.Unmarshal(raw, &rsl)
-	if err != nil {
+	rsl := ConfigFromDefaults()
+	if err := json.Unmarshal(raw, &rsl); err != nil {
 		return nil, err
 	}
 	return &rsl, nil
@@ -31,7 +153,17 @@ func ConfigFromJSON(path string) (*Config, error) {
 
 // Returns a Config instance with default values.
 func ConfigFromDefaults() Config {
-	return Config{}
+	return Config{
+		RetryMaxAttempts:    5,
+		RetryBaseDelay:      30,
+		Workers:             4,
+		ShutdownTimeout:     30,
+		ShowRefreshInterval: 3600,
+		Locale:              "de",
+		Handlers: []HandlerConfig{
+			{Name: "radio_upload", Enabled: true},
+		},
+	}
 }
 
 // Saves a Config instance in JSON file.
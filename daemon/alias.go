@@ -0,0 +1,112 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+const showAliasBucket = "ShowAlias"
+
+// Maps a show name as entered by producers (abbreviation, former title, ...)
+// to an Omnia show. Aliases are checked before the fuzzy show matching.
+type ShowAlias struct {
+	Alias   string    `json:"alias"`
+	ShowID  int       `json:"show_id"`
+	Created time.Time `json:"created"`
+}
+
+// Adds an alias for the given show. An existing alias with the same name is
+// replaced. Names are compared case insensitive and ignoring punctuation.
+// Fails if the show isn't part of the catalog.
+func AddAlias(db *bbolt.DB, catalog *ShowCatalog, alias string, showID int) error {
+	key := normalizeShowName(alias)
+	if key == "" {
+		return fmt.Errorf("alias can't be empty")
+	}
+	shows, err := catalog.Shows()
+	if err != nil {
+		return fmt.Errorf("failed to check show %d, %s", showID, err)
+	}
+	found := false
+	for _, show := range shows {
+		if show.General.Id == showID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("show %d doesn't exist", showID)
+	}
+	dt, err := json.Marshal(ShowAlias{
+		Alias:   alias,
+		ShowID:  showID,
+		Created: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(showAliasBucket))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(key), dt)
+	})
+}
+
+// Removes an alias. Fails if the alias doesn't exist.
+func RemoveAlias(db *bbolt.DB, alias string) error {
+	key := []byte(normalizeShowName(alias))
+	return db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(showAliasBucket))
+		if bucket == nil || bucket.Get(key) == nil {
+			return fmt.Errorf("alias '%s' not found", alias)
+		}
+		return bucket.Delete(key)
+	})
+}
+
+// Returns all aliases ordered by their normalized name.
+func ListAliases(db *bbolt.DB) ([]ShowAlias, error) {
+	var rsl []ShowAlias
+	err := db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(showAliasBucket))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var alias ShowAlias
+			if err := json.Unmarshal(v, &alias); err != nil {
+				return fmt.Errorf("invalid alias %s, %s", k, err)
+			}
+			rsl = append(rsl, alias)
+			return nil
+		})
+	})
+	return rsl, err
+}
+
+// Returns the alias for the given show name, nil if there is none.
+func LookupAlias(db *bbolt.DB, name string) (*ShowAlias, error) {
+	var rsl *ShowAlias
+	err := db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(showAliasBucket))
+		if bucket == nil {
+			return nil
+		}
+		dt := bucket.Get([]byte(normalizeShowName(name)))
+		if dt == nil {
+			return nil
+		}
+		var alias ShowAlias
+		if err := json.Unmarshal(dt, &alias); err != nil {
+			return fmt.Errorf("invalid alias for %s, %s", name, err)
+		}
+		rsl = &alias
+		return nil
+	})
+	return rsl, err
+}
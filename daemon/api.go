@@ -0,0 +1,263 @@
+package daemon
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+	"go.etcd.io/bbolt"
+)
+
+// Filter criteria for listing processing records.
+type itemFilter struct {
+	Status string
+	From   time.Time
+	To     time.Time
+	Show   string
+}
+
+// Parses the filter from the query parameters of a request. Dates are
+// accepted as RFC 3339 or as YYYY-MM-DD, the latter includes the whole day.
+func itemFilterFromQuery(r *http.Request) (*itemFilter, error) {
+	query := r.URL.Query()
+	rsl := itemFilter{
+		Status: query.Get("status"),
+		Show:   strings.ToLower(query.Get("show")),
+	}
+	var err error
+	if value := query.Get("from"); value != "" {
+		if rsl.From, _, err = parseQueryDate(value); err != nil {
+			return nil, fmt.Errorf("invalid from date '%s'", value)
+		}
+	}
+	if value := query.Get("to"); value != "" {
+		var dateOnly bool
+		if rsl.To, dateOnly, err = parseQueryDate(value); err != nil {
+			return nil, fmt.Errorf("invalid to date '%s'", value)
+		}
+		if dateOnly {
+			rsl.To = rsl.To.AddDate(0, 0, 1)
+		}
+	}
+	return &rsl, nil
+}
+
+func parseQueryDate(value string) (time.Time, bool, error) {
+	if rsl, err := time.Parse(time.RFC3339, value); err == nil {
+		return rsl, false, nil
+	}
+	rsl, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	return rsl, true, err
+}
+
+// States whether a record matches the filter.
+func (f itemFilter) matches(rec ProcessingRecord) bool {
+	if f.Status != "" && rec.Status != f.Status {
+		return false
+	}
+	if !f.From.IsZero() && rec.Received.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !rec.Received.Before(f.To) {
+		return false
+	}
+	if f.Show != "" &&
+		!strings.Contains(strings.ToLower(rec.Show), f.Show) &&
+		strconv.Itoa(rec.ShowID) != f.Show {
+		return false
+	}
+	return true
+}
+
+// Lists the processing records matching the filter given by the query
+// parameters status, from, to and show. The newest records come first. The
+// notification bodies are omitted, use [Daemon.itemHandler] for the details.
+func (d Daemon) listItemsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := itemFilterFromQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rsl := []ProcessingRecord{}
+	err = d.DB.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(radioUploadBucket))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			rec, err := processingRecordFromBytes(string(k), v)
+			if err != nil {
+				logrus.Errorf("invalid processing record for %s, %s", k, err)
+				return nil
+			}
+			if filter.matches(*rec) {
+				rec.Notification = nil
+				rsl = append(rsl, *rec)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		logrus.Error(err)
+		http.Error(w, "failed to read processing records", http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(rsl, func(i, j int) bool {
+		return rsl[i].Received.After(rsl[j].Received)
+	})
+	writeJSON(w, http.StatusOK, rsl)
+}
+
+// Returns the full processing record for the item ID given in the path.
+func (d Daemon) itemHandler(w http.ResponseWriter, r *http.Request) {
+	rec, err := loadProcessingRecord(d.DB, chi.URLParam(r, "id"))
+	if err != nil {
+		logrus.Error(err)
+		http.Error(w, "failed to read processing record", http.StatusInternalServerError)
+		return
+	}
+	if rec == nil {
+		http.Error(w, "item not found", http.StatusNotFound)
+		return
+	}
+	// Records written before the secret was removed still contain it.
+	rec.Notification = withoutSecret(rec.Notification)
+	writeJSON(w, http.StatusOK, rec)
+}
+
+// Runs the task pipeline again for the item ID given in the path and returns
+// the resulting processing record.
+func (d Daemon) reprocessHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "item id has to be numeric", http.StatusBadRequest)
+		return
+	}
+	if err := d.Reprocess(id); err != nil {
+		logrus.Errorf("failed to reprocess item %d, %s", id, err)
+		http.Error(w, fmt.Sprintf("failed to reprocess item, %s", err), http.StatusInternalServerError)
+		return
+	}
+	rec, err := loadProcessingRecord(d.DB, strconv.Itoa(id))
+	if err != nil {
+		logrus.Error(err)
+		http.Error(w, "failed to read processing record", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, rec)
+}
+
+// Fetches the list of shows from Omnia without waiting for the refresh
+// interval. Useful after a new show was created.
+func (d Daemon) refreshShowsHandler(w http.ResponseWriter, r *http.Request) {
+	if err := d.Shows.Refresh(); err != nil {
+		logrus.Errorf("failed to refresh show catalog, %s", err)
+		http.Error(w, fmt.Sprintf("failed to refresh shows, %s", err), http.StatusBadGateway)
+		return
+	}
+	count, updated := d.Shows.Status()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"shows":   count,
+		"updated": updated,
+	})
+}
+
+// Lists all aliases.
+func (d Daemon) listAliasesHandler(w http.ResponseWriter, r *http.Request) {
+	aliases, err := ListAliases(d.DB)
+	if err != nil {
+		logrus.Error(err)
+		http.Error(w, "failed to read aliases", http.StatusInternalServerError)
+		return
+	}
+	if aliases == nil {
+		aliases = []ShowAlias{}
+	}
+	writeJSON(w, http.StatusOK, aliases)
+}
+
+// Adds or replaces the alias given as JSON with the fields alias and
+// show_id. The show has to exist in Omnia.
+func (d Daemon) addAliasHandler(w http.ResponseWriter, r *http.Request) {
+	var alias ShowAlias
+	if err := json.NewDecoder(r.Body).Decode(&alias); err != nil {
+		http.Error(w, fmt.Sprintf("malformed alias, %s", err), http.StatusBadRequest)
+		return
+	}
+	if err := AddAlias(d.DB, d.Shows, alias.Alias, alias.ShowID); err != nil {
+		http.Error(w, fmt.Sprintf("failed to add alias, %s", err), http.StatusBadRequest)
+		return
+	}
+	rsl, err := LookupAlias(d.DB, alias.Alias)
+	if err != nil || rsl == nil {
+		logrus.Error(err)
+		http.Error(w, "failed to read alias", http.StatusInternalServerError)
+		return
+	}
+	logrus.Infof("added alias '%s' for show %d", rsl.Alias, rsl.ShowID)
+	writeJSON(w, http.StatusCreated, rsl)
+}
+
+// Removes the alias given in the path.
+func (d Daemon) removeAliasHandler(w http.ResponseWriter, r *http.Request) {
+	name, err := url.PathUnescape(chi.URLParam(r, "alias"))
+	if err != nil {
+		http.Error(w, "malformed alias", http.StatusBadRequest)
+		return
+	}
+	alias, err := LookupAlias(d.DB, name)
+	if err != nil {
+		logrus.Error(err)
+		http.Error(w, "failed to read alias", http.StatusInternalServerError)
+		return
+	}
+	if alias == nil {
+		http.Error(w, "alias not found", http.StatusNotFound)
+		return
+	}
+	if err := RemoveAlias(d.DB, name); err != nil {
+		logrus.Error(err)
+		http.Error(w, fmt.Sprintf("failed to remove alias, %s", err), http.StatusInternalServerError)
+		return
+	}
+	logrus.Infof("removed alias '%s'", alias.Alias)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Middleware which only lets requests with the configured admin token pass.
+// The token has to be given as bearer token in the Authorization header.
+func (d Daemon) requireAdminToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d.AdminToken == "" {
+			http.Error(w, "admin endpoints are disabled, no admin token configured", http.StatusForbidden)
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(d.AdminToken)) != 1 {
+			logrus.Warnf("unauthorized request to %s from %s", r.URL.Path, r.RemoteAddr)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	dt, err := json.Marshal(data)
+	if err != nil {
+		logrus.Error(err)
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(dt)
+}
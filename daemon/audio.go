@@ -0,0 +1,482 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/alex-berlin-tv/nexx_omnia_go/omnia"
+	"github.com/sirupsen/logrus"
+)
+
+// Settings of the technical check of the uploaded audio file. The file is
+// analyzed with ffprobe and ffmpeg, which have to be installed.
+type AudioCheckSettings struct {
+	// URL or path of the uploaded file as text/template. Available fields are
+	// .ID, .GID, .Hash and .Domain of the item. The check is disabled if
+	// empty.
+	Source string `json:"source,omitempty"`
+	// Paths to the ffprobe and ffmpeg executables.
+	FFprobe string `json:"ffprobe"`
+	FFmpeg  string `json:"ffmpeg"`
+	// Maximum time in seconds for the analysis of a file.
+	Timeout int `json:"timeout"`
+	// Integrated loudness in LUFS and the allowed deviation in LU.
+	TargetLoudness    float64 `json:"target_loudness"`
+	LoudnessTolerance float64 `json:"loudness_tolerance"`
+	// Maximum true peak in dBTP.
+	MaxTruePeak float64 `json:"max_true_peak"`
+	// Allowed sample rates in Hz. All are allowed if empty.
+	SampleRates []int `json:"sample_rates"`
+	// Allowed numbers of channels. All are allowed if empty.
+	Channels []int `json:"channels"`
+	// Silence at the start or end of the file longer than this number of
+	// seconds is reported.
+	MaxSilence float64 `json:"max_silence"`
+	// Level in dB below which the audio counts as silence.
+	SilenceThreshold float64 `json:"silence_threshold"`
+	// Allowed deviation in seconds from the length of the slot in the
+	// schedule. Only checked if the slot states its length.
+	DurationTolerance int `json:"duration_tolerance"`
+}
+
+// Returns the default settings for the audio check, following EBU R128.
+func DefaultAudioCheckSettings() AudioCheckSettings {
+	return AudioCheckSettings{
+		FFprobe:           "ffprobe",
+		FFmpeg:            "ffmpeg",
+		Timeout:           600,
+		TargetLoudness:    -23,
+		LoudnessTolerance: 1,
+		MaxTruePeak:       -1,
+		SampleRates:       []int{44100, 48000},
+		Channels:          []int{2},
+		MaxSilence:        3,
+		SilenceThreshold:  -50,
+		DurationTolerance: 300,
+	}
+}
+
+// Checks for an invalid source template and values out of range.
+func (s AudioCheckSettings) validate() error {
+	if s.Source == "" {
+		return nil
+	}
+	if _, err := template.New("source").Parse(s.Source); err != nil {
+		return fmt.Errorf("invalid audio source, %s", err)
+	}
+	if s.Timeout <= 0 {
+		return fmt.Errorf("audio check timeout has to be positive")
+	}
+	if s.LoudnessTolerance < 0 || s.DurationTolerance < 0 {
+		return fmt.Errorf("audio check tolerances can't be negative")
+	}
+	if s.MaxSilence <= 0 {
+		return fmt.Errorf("max silence has to be positive")
+	}
+	return nil
+}
+
+// Fields available in the source template.
+type audioSource struct {
+	ID     string
+	GID    int
+	Hash   string
+	Domain int
+}
+
+// Returns the URL or path of the uploaded file.
+func (s AudioCheckSettings) source(src audioSource) (string, error) {
+	tpl, err := template.New("source").Parse(s.Source)
+	if err != nil {
+		return "", fmt.Errorf("invalid audio source, %s", err)
+	}
+	var rsl bytes.Buffer
+	if err := tpl.Execute(&rsl, src); err != nil {
+		return "", fmt.Errorf("failed to build audio source, %s", err)
+	}
+	return rsl.String(), nil
+}
+
+// Technical properties of an audio file.
+type audioAnalysis struct {
+	Duration   time.Duration `json:"duration"`
+	SampleRate int           `json:"sample_rate"`
+	Channels   int           `json:"channels"`
+	// Integrated loudness in LUFS.
+	Loudness float64 `json:"loudness"`
+	// True peak in dBTP.
+	TruePeak        float64       `json:"true_peak"`
+	LeadingSilence  time.Duration `json:"leading_silence"`
+	TrailingSilence time.Duration `json:"trailing_silence"`
+	// SHA-256 of the decoded audio. Unlike a hash of the file it doesn't
+	// change with the tags or the container.
+	Hash string `json:"hash"`
+}
+
+// Analysis of an uploaded file stored in the [ProcessingRecord], so later
+// runs don't have to analyze the same file again.
+type cachedAudio struct {
+	// Location of the analyzed file.
+	Source string `json:"source"`
+	// Hash of the file in Omnia, changes if the file is replaced.
+	FileHash string        `json:"file_hash"`
+	Analysis audioAnalysis `json:"analysis"`
+}
+
+// Analyzes the file with ffprobe (format) and ffmpeg (loudness, true peak,
+// silence and hash of the audio).
+func analyzeAudio(settings AudioCheckSettings, src string) (*audioAnalysis, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(settings.Timeout)*time.Second)
+	defer cancel()
+	probe, err := exec.CommandContext(ctx, settings.FFprobe,
+		"-v", "error",
+		"-print_format", "json",
+		"-show_entries", "format=duration:stream=codec_type,sample_rate,channels",
+		src,
+	).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe failed, %s", commandError(err))
+	}
+	rsl, err := parseProbe(probe)
+	if err != nil {
+		return nil, err
+	}
+	filter := fmt.Sprintf("ebur128=peak=true,silencedetect=noise=%gdB:d=%g", settings.SilenceThreshold, settings.MaxSilence)
+	cmd := exec.CommandContext(ctx, settings.FFmpeg,
+		"-hide_banner", "-nostats", "-nostdin",
+		"-i", src,
+		"-vn", "-af", filter,
+		"-f", "null", "-",
+		"-map", "0:a:0", "-f", "hash", "-hash", "sha256", "-",
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg failed, %s: %s", commandError(err), snippetOf(stderr.String()))
+	}
+	if err := parseLevels(stderr.String(), rsl); err != nil {
+		return nil, err
+	}
+	m := audioHashPattern.FindStringSubmatch(stdout.String())
+	if m == nil {
+		return nil, fmt.Errorf("no audio hash in ffmpeg output")
+	}
+	rsl.Hash = strings.ToLower(m[1])
+	return rsl, nil
+}
+
+// Returns the error of a command including its output on stderr if there is
+// any.
+func commandError(err error) string {
+	if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) != 0 {
+		return fmt.Sprintf("%s: %s", err, snippetOf(string(exitErr.Stderr)))
+	}
+	return err.Error()
+}
+
+// Returns the last line of a command output.
+func snippetOf(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// Output of ffprobe.
+type probeOutput struct {
+	Streams []struct {
+		CodecType  string `json:"codec_type"`
+		SampleRate string `json:"sample_rate"`
+		Channels   int    `json:"channels"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+}
+
+// Reads duration, sample rate and channels of the first audio stream from
+// the output of ffprobe.
+func parseProbe(dt []byte) (*audioAnalysis, error) {
+	var probe probeOutput
+	if err := json.Unmarshal(dt, &probe); err != nil {
+		return nil, fmt.Errorf("invalid ffprobe output, %s", err)
+	}
+	seconds, err := strconv.ParseFloat(probe.Format.Duration, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid duration '%s' in ffprobe output", probe.Format.Duration)
+	}
+	for _, stream := range probe.Streams {
+		if stream.CodecType != "audio" {
+			continue
+		}
+		sampleRate, err := strconv.Atoi(stream.SampleRate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sample rate '%s' in ffprobe output", stream.SampleRate)
+		}
+		return &audioAnalysis{
+			Duration:   secondsToDuration(seconds),
+			SampleRate: sampleRate,
+			Channels:   stream.Channels,
+		}, nil
+	}
+	return nil, fmt.Errorf("file contains no audio stream")
+}
+
+var (
+	loudnessPattern     = regexp.MustCompile(`(?m)^\s*I:\s+(\S+) LUFS`)
+	truePeakPattern     = regexp.MustCompile(`(?m)^\s*Peak:\s+(\S+) dBFS`)
+	silenceStartPattern = regexp.MustCompile(`silence_start: (\S+)`)
+	silenceEndPattern   = regexp.MustCompile(`silence_end: (\S+)`)
+	audioHashPattern    = regexp.MustCompile(`(?i)SHA256=([0-9a-f]{64})`)
+)
+
+// Reads loudness, true peak and the silence at start and end from the
+// output of the ebur128 and silencedetect filters of ffmpeg.
+func parseLevels(output string, rsl *audioAnalysis) error {
+	summary := output
+	if index := strings.LastIndex(output, "Summary:"); index != -1 {
+		summary = output[index:]
+	}
+	m := loudnessPattern.FindStringSubmatch(summary)
+	if m == nil {
+		return fmt.Errorf("no integrated loudness in ffmpeg output")
+	}
+	loudness, err := parseLevel(m[1])
+	if err != nil {
+		return fmt.Errorf("invalid integrated loudness '%s' in ffmpeg output", m[1])
+	}
+	m = truePeakPattern.FindStringSubmatch(summary)
+	if m == nil {
+		return fmt.Errorf("no true peak in ffmpeg output")
+	}
+	truePeak, err := parseLevel(m[1])
+	if err != nil {
+		return fmt.Errorf("invalid true peak '%s' in ffmpeg output", m[1])
+	}
+	rsl.Loudness = loudness
+	rsl.TruePeak = truePeak
+	// Silence is reported as pairs of start and end. A start without an end
+	// lasts until the end of the file.
+	starts := silenceStartPattern.FindAllStringSubmatch(output, -1)
+	ends := silenceEndPattern.FindAllStringSubmatch(output, -1)
+	duration := rsl.Duration.Seconds()
+	for i, start := range starts {
+		from, err := strconv.ParseFloat(start[1], 64)
+		if err != nil {
+			continue
+		}
+		to := duration
+		if i < len(ends) {
+			if end, err := strconv.ParseFloat(ends[i][1], 64); err == nil {
+				to = end
+			}
+		}
+		// Filters report the boundaries with a small offset.
+		if from <= 0.1 {
+			rsl.LeadingSilence = secondsToDuration(to - math.Max(from, 0))
+		}
+		if to >= duration-0.1 {
+			rsl.TrailingSilence = secondsToDuration(duration - from)
+		}
+	}
+	return nil
+}
+
+// Level stored for digital silence, which ffmpeg reports as -inf. Infinite
+// values can't be stored as JSON. Below the noise floor of 24 bit audio.
+const silentLevel = -144.0
+
+// Parses a level in dB as reported by ffmpeg.
+func parseLevel(value string) (float64, error) {
+	rsl, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsInf(rsl, -1) {
+		return silentLevel, nil
+	}
+	if math.IsInf(rsl, 0) || math.IsNaN(rsl) {
+		return 0, fmt.Errorf("invalid level %s", value)
+	}
+	return rsl, nil
+}
+
+// Analyzes the uploaded file and reports each violation of the technical
+// requirements as a separate result with manual tasks. The length is checked
+// against the slot of the show the release date falls on. Also returns the
+// analysis, nil if the check is disabled or failed.
+func (u RadioUpload) checkAudio(rec *ProcessingRecord, show *omnia.MediaResultItem, date *dateCandidate) ([]plannedTask, *audioAnalysis) {
+	settings := u.Settings.Audio
+	if settings.Source == "" {
+		return nil, nil
+	}
+	src, err := settings.source(audioSource{
+		ID:     u.Notification.Item.ID,
+		GID:    u.Notification.Item.GID,
+		Hash:   u.Notification.Data.General.Hash,
+		Domain: u.Notification.Item.Domain,
+	})
+	if err == nil {
+		var analysis *audioAnalysis
+		analysis, err = u.analyzeAudio(rec, src)
+		if err == nil {
+			return u.audioTasks(analysis, show, date), analysis
+		}
+	}
+	logrus.Errorf("audio check of item %s failed, %s", u.Notification.Item.ID, err)
+	return []plannedTask{resultOnlyTask(taskResult{
+		Success: false,
+		Omit:    false,
+		Result:  u.Messages.Text("audio_check_failed", err),
+		ManualTasks: []string{
+			u.Messages.Text("audio_check_task"),
+		},
+	})}, nil
+}
+
+// Returns the analysis of the uploaded file. The analysis of a previous run
+// is reused as long as the file didn't change. A new analysis is stored in
+// the record right away, so a retry doesn't run ffmpeg again.
+func (u RadioUpload) analyzeAudio(rec *ProcessingRecord, src string) (*audioAnalysis, error) {
+	fileHash := u.Notification.Data.General.Hash
+	if cached := rec.Audio; cached != nil && cached.Source == src && cached.FileHash == fileHash {
+		rsl := cached.Analysis
+		return &rsl, nil
+	}
+	rsl, err := analyzeAudio(u.Settings.Audio, src)
+	if err != nil {
+		return nil, err
+	}
+	rec.Audio = &cachedAudio{
+		Source:   src,
+		FileHash: fileHash,
+		Analysis: *rsl,
+	}
+	if err := u.saveRecord(rec); err != nil {
+		logrus.Error(err)
+	}
+	return rsl, nil
+}
+
+// Compares the analysis with the requirements of the settings.
+func (u RadioUpload) audioTasks(analysis *audioAnalysis, show *omnia.MediaResultItem, date *dateCandidate) []plannedTask {
+	settings := u.Settings.Audio
+	var rsl []plannedTask
+	violation := func(result string, task string) {
+		rsl = append(rsl, resultOnlyTask(taskResult{
+			Success:     false,
+			Omit:        false,
+			Result:      result,
+			ManualTasks: []string{task},
+			Audio:       analysis,
+		}))
+	}
+	if show != nil {
+		if scheduled := u.Schedule.For(show.General.Id, show.General.Title); scheduled != nil {
+			length := scheduled.length(date)
+			diff := analysis.Duration - length
+			if diff < 0 {
+				diff = -diff
+			}
+			if length != 0 && diff > time.Duration(settings.DurationTolerance)*time.Second {
+				violation(
+					u.Messages.Text("audio_duration", formatLength(analysis.Duration), formatLength(length)),
+					u.Messages.Text("audio_duration_task", formatLength(length)),
+				)
+			}
+		}
+	}
+	if math.Abs(analysis.Loudness-settings.TargetLoudness) > settings.LoudnessTolerance {
+		violation(
+			u.Messages.Text("audio_loudness", analysis.Loudness, settings.TargetLoudness),
+			u.Messages.Text("audio_loudness_task", settings.TargetLoudness),
+		)
+	}
+	if analysis.TruePeak > settings.MaxTruePeak {
+		violation(
+			u.Messages.Text("audio_true_peak", analysis.TruePeak, settings.MaxTruePeak),
+			u.Messages.Text("audio_true_peak_task", settings.MaxTruePeak),
+		)
+	}
+	if !allowedInt(settings.SampleRates, analysis.SampleRate) {
+		violation(
+			u.Messages.Text("audio_sample_rate", analysis.SampleRate, formatInts(settings.SampleRates)),
+			u.Messages.Text("audio_format_task"),
+		)
+	}
+	if !allowedInt(settings.Channels, analysis.Channels) {
+		violation(
+			u.Messages.Text("audio_channels", analysis.Channels, formatInts(settings.Channels)),
+			u.Messages.Text("audio_format_task"),
+		)
+	}
+	if analysis.LeadingSilence != 0 {
+		violation(
+			u.Messages.Text("audio_leading_silence", analysis.LeadingSilence.Seconds()),
+			u.Messages.Text("audio_silence_task"),
+		)
+	}
+	if analysis.TrailingSilence != 0 {
+		violation(
+			u.Messages.Text("audio_trailing_silence", analysis.TrailingSilence.Seconds()),
+			u.Messages.Text("audio_silence_task"),
+		)
+	}
+	if len(rsl) != 0 {
+		return rsl
+	}
+	return []plannedTask{resultOnlyTask(taskResult{
+		Success: true,
+		Omit:    true,
+		Result:  u.Messages.Text("audio_ok"),
+		Audio:   analysis,
+	})}
+}
+
+// Converts fractional seconds to a duration.
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// Formats a length as H:MM:SS or M:SS.
+func formatLength(d time.Duration) string {
+	d = d.Round(time.Second)
+	hours := int(d / time.Hour)
+	minutes := int(d % time.Hour / time.Minute)
+	seconds := int(d % time.Minute / time.Second)
+	if hours > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", hours, minutes, seconds)
+	}
+	return fmt.Sprintf("%d:%02d", minutes, seconds)
+}
+
+// Returns the numbers as a comma separated list.
+func formatInts(values []int) string {
+	var rsl []string
+	for _, value := range values {
+		rsl = append(rsl, strconv.Itoa(value))
+	}
+	return strings.Join(rsl, ", ")
+}
+
+// States whether the value is allowed. Everything is allowed if the list is
+// empty.
+func allowedInt(allowed []int, value int) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, candidate := range allowed {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
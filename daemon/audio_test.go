@@ -0,0 +1,212 @@
+package daemon
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseProbe(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   audioAnalysis
+		fails  bool
+	}{
+		{
+			name: "audio stream",
+			output: `{
+    "streams": [
+        {"index": 0, "codec_name": "mp3", "codec_type": "audio", "sample_rate": "44100", "channels": 2, "channel_layout": "stereo"}
+    ],
+    "format": {"filename": "upload.mp3", "format_name": "mp3", "duration": "3597.531429", "bit_rate": "192000"}
+}`,
+			want: audioAnalysis{Duration: 3597*time.Second + 531429*time.Microsecond, SampleRate: 44100, Channels: 2},
+		},
+		{
+			name: "cover before audio",
+			output: `{
+    "streams": [
+        {"index": 0, "codec_name": "mjpeg", "codec_type": "video"},
+        {"index": 1, "codec_name": "aac", "codec_type": "audio", "sample_rate": "48000", "channels": 1}
+    ],
+    "format": {"duration": "60.000000"}
+}`,
+			want: audioAnalysis{Duration: time.Minute, SampleRate: 48000, Channels: 1},
+		},
+		{
+			name: "no audio stream",
+			output: `{
+    "streams": [{"index": 0, "codec_name": "mjpeg", "codec_type": "video"}],
+    "format": {"duration": "60.000000"}
+}`,
+			fails: true,
+		},
+		{
+			name: "missing duration",
+			output: `{
+    "streams": [{"index": 0, "codec_type": "audio", "sample_rate": "44100", "channels": 2}],
+    "format": {}
+}`,
+			fails: true,
+		},
+		{
+			name: "invalid sample rate",
+			output: `{
+    "streams": [{"index": 0, "codec_type": "audio", "sample_rate": "N/A", "channels": 2}],
+    "format": {"duration": "60.000000"}
+}`,
+			fails: true,
+		},
+		{
+			name:   "no JSON",
+			output: "upload.mp3: Invalid data found when processing input",
+			fails:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseProbe([]byte(tt.output))
+			if (err != nil) != tt.fails {
+				t.Fatalf("got error %v, want failure %t", err, tt.fails)
+			}
+			if tt.fails {
+				return
+			}
+			if !closeDurations(got.Duration, tt.want.Duration) || got.SampleRate != tt.want.SampleRate || got.Channels != tt.want.Channels {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+// Returns ebur128 output of ffmpeg with the given summary values.
+func ebur128Output(loudness, peak string) string {
+	return `[Parsed_ebur128_0 @ 0x5581c3f0a2c0] t: 0.0999773  TARGET:-23 LUFS    M:-120.7 S:-120.7     I: -70.0 LUFS       LRA:   0.0 LU  FTPK: -inf dBFS  TPK: -inf dBFS
+[Parsed_ebur128_0 @ 0x5581c3f0a2c0] Summary:
+
+  Integrated loudness:
+    I:         ` + loudness + ` LUFS
+    Threshold: -33.1 LUFS
+
+  Loudness range:
+    LRA:         5.2 LU
+    Threshold: -43.2 LUFS
+    LRA low:   -27.1 LUFS
+    LRA high:  -21.9 LUFS
+
+  True peak:
+    Peak:       ` + peak + ` dBFS
+`
+}
+
+func TestParseLevels(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		loudness float64
+		peak     float64
+		leading  time.Duration
+		trailing time.Duration
+		fails    bool
+	}{
+		{
+			name:     "no silence",
+			output:   ebur128Output("-23.0", "-1.5"),
+			loudness: -23,
+			peak:     -1.5,
+		},
+		{
+			name: "leading silence",
+			output: `[silencedetect @ 0x5581c3f0b100] silence_start: 0
+[silencedetect @ 0x5581c3f0b100] silence_end: 2.5 | silence_duration: 2.5
+` + ebur128Output("-23.0", "-1.5"),
+			loudness: -23,
+			peak:     -1.5,
+			leading:  2500 * time.Millisecond,
+		},
+		{
+			name: "start without end",
+			output: `[silencedetect @ 0x5581c3f0b100] silence_start: 55.2
+` + ebur128Output("-24.3", "-0.8"),
+			loudness: -24.3,
+			peak:     -0.8,
+			trailing: 4800 * time.Millisecond,
+		},
+		{
+			name: "silence at start and end",
+			output: `[silencedetect @ 0x5581c3f0b100] silence_start: -0.0213333
+[silencedetect @ 0x5581c3f0b100] silence_end: 3 | silence_duration: 3.02133
+[silencedetect @ 0x5581c3f0b100] silence_start: 20
+[silencedetect @ 0x5581c3f0b100] silence_end: 25 | silence_duration: 5
+[silencedetect @ 0x5581c3f0b100] silence_start: 57
+[silencedetect @ 0x5581c3f0b100] silence_end: 60 | silence_duration: 3
+` + ebur128Output("-23.0", "-1.5"),
+			loudness: -23,
+			peak:     -1.5,
+			leading:  3 * time.Second,
+			trailing: 3 * time.Second,
+		},
+		{
+			name: "silence in the middle",
+			output: `[silencedetect @ 0x5581c3f0b100] silence_start: 20
+[silencedetect @ 0x5581c3f0b100] silence_end: 25 | silence_duration: 5
+` + ebur128Output("-23.0", "-1.5"),
+			loudness: -23,
+			peak:     -1.5,
+		},
+		{
+			name: "silent file",
+			output: `[silencedetect @ 0x5581c3f0b100] silence_start: 0
+` + ebur128Output("-70.0", "-inf"),
+			loudness: -70,
+			peak:     silentLevel,
+			leading:  time.Minute,
+			trailing: time.Minute,
+		},
+		{
+			name:   "no summary",
+			output: "[silencedetect @ 0x5581c3f0b100] silence_start: 0\n",
+			fails:  true,
+		},
+		{
+			name:   "no true peak",
+			output: strings.Split(ebur128Output("-23.0", "-1.5"), "  True peak:")[0],
+			fails:  true,
+		},
+		{
+			name:   "invalid loudness",
+			output: ebur128Output("nan", "-1.5"),
+			fails:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rsl := audioAnalysis{Duration: time.Minute}
+			err := parseLevels(tt.output, &rsl)
+			if (err != nil) != tt.fails {
+				t.Fatalf("got error %v, want failure %t", err, tt.fails)
+			}
+			if tt.fails {
+				return
+			}
+			if rsl.Loudness != tt.loudness || rsl.TruePeak != tt.peak {
+				t.Errorf("got loudness %g and peak %g, want %g and %g", rsl.Loudness, rsl.TruePeak, tt.loudness, tt.peak)
+			}
+			if !closeDurations(rsl.LeadingSilence, tt.leading) || !closeDurations(rsl.TrailingSilence, tt.trailing) {
+				t.Errorf("got silence %s at start and %s at end, want %s and %s", rsl.LeadingSilence, rsl.TrailingSilence, tt.leading, tt.trailing)
+			}
+			// The analysis is stored in the processing record.
+			if _, err := json.Marshal(rsl); err != nil {
+				t.Errorf("analysis can't be stored, %s", err)
+			}
+		})
+	}
+}
+
+// States whether the durations differ by less than a millisecond.
+func closeDurations(a, b time.Duration) bool {
+	diff := a - b
+	return diff > -time.Millisecond && diff < time.Millisecond
+}
@@ -0,0 +1,103 @@
+package daemon
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/alex-berlin-tv/nexx_omnia_go/omnia"
+	"github.com/alex-berlin-tv/nexx_omnia_go/omnia/enums"
+	"github.com/alex-berlin-tv/nexx_omnia_go/omnia/params"
+	"github.com/sirupsen/logrus"
+)
+
+// A task of the [RadioUpload] handler. Instead of updating the item on its
+// own, a task only states the changes it wants to make. The changes of all
+// tasks are applied to the item in a single update call, so a failure can't
+// leave the item in a partially updated state.
+type plannedTask struct {
+	// Fields of the item to update. Empty if the task has nothing to change.
+	Fields params.Custom
+	// Result of the task if the changes were applied or if there are none.
+	Result taskResult
+	// Returns the result of the task if applying the changes failed.
+	Failure func(err error) taskResult
+}
+
+// Returns a task which only reports the given result without changing the
+// item.
+func resultOnlyTask(rsl taskResult) plannedTask {
+	return plannedTask{Result: rsl}
+}
+
+// Merges the changes of all tasks and applies them with one update call.
+// Returns the results of all tasks in the same order.
+func (u RadioUpload) applyTasks(tasks []plannedTask) taskResults {
+	changes := params.Custom{}
+	for _, task := range tasks {
+		for field, value := range task.Fields {
+			if existing, ok := changes[field]; ok && existing != value {
+				logrus.Warnf("conflicting changes for field %s, '%s' replaces '%s'", field, value, existing)
+			}
+			changes[field] = value
+		}
+	}
+	var err error
+	if len(changes) != 0 {
+		err = u.updateItem(changes)
+	}
+	var rsl taskResults
+	for _, task := range tasks {
+		if err != nil && len(task.Fields) != 0 {
+			rsl = append(rsl, task.Failure(err))
+			continue
+		}
+		rsl = append(rsl, task.Result)
+	}
+	return rsl
+}
+
+// Updates the given fields of the item. In dry-run mode the update is only
+// printed.
+func (u RadioUpload) updateItem(changes params.Custom) error {
+	if u.DryRun {
+		var fields []string
+		for field := range changes {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		fmt.Printf("[dry-run] Omnia update of %s item %d:\n", enums.AudioStreamType, u.Notification.Data.General.ID)
+		for _, field := range fields {
+			fmt.Printf("  %s = '%s'\n", field, changes[field])
+		}
+		return nil
+	}
+	rsp, err := u.Omnia.Update(enums.AudioStreamType, u.Notification.Data.General.ID, changes)
+	if err == nil {
+		return nil
+	}
+	// Omnia reports novalidcontext when linking a show even though the
+	// update was successful. As the hint doesn't tell which field caused it,
+	// the other fields are written again without the show.
+	if _, ok := changes["show"]; ok && isNoValidContext(rsp) {
+		logrus.Debugf("ignored novalidcontext error while linking show, %s", err)
+		rest := params.Custom{}
+		for field, value := range changes {
+			if field != "show" {
+				rest[field] = value
+			}
+		}
+		if len(rest) == 0 {
+			return nil
+		}
+		_, err = u.Omnia.Update(enums.AudioStreamType, u.Notification.Data.General.ID, rest)
+		if err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to update item %d, %s", u.Notification.Data.General.ID, err)
+}
+
+// States whether Omnia answered with the novalidcontext error hint.
+func isNoValidContext(rsp *omnia.Response[any]) bool {
+	return rsp != nil && rsp.Metadata.ErrorHint != nil && *rsp.Metadata.ErrorHint == "novalidcontext"
+}
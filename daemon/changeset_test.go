@@ -0,0 +1,146 @@
+package daemon
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/alex-berlin-tv/nexx_omnia_go/notification"
+	"github.com/alex-berlin-tv/nexx_omnia_go/omnia"
+	"github.com/alex-berlin-tv/nexx_omnia_go/omnia/enums"
+	"github.com/alex-berlin-tv/nexx_omnia_go/omnia/params"
+)
+
+// Fake which answers the first update with the given error hint.
+type hintOmnia struct {
+	*fakeOmnia
+	hint     string
+	answered bool
+}
+
+func (h *hintOmnia) Update(streamType enums.StreamType, id int, parameters params.Custom) (*omnia.Response[any], error) {
+	rsp, err := h.fakeOmnia.Update(streamType, id, parameters)
+	if err != nil || h.answered {
+		return rsp, err
+	}
+	h.answered = true
+	return &omnia.Response[any]{
+		Metadata: omnia.ResponseMetadata{Status: 400, ErrorHint: &h.hint},
+	}, errors.New(h.hint)
+}
+
+func TestApplyTasks(t *testing.T) {
+	showTask := plannedTask{
+		Fields: params.Custom{"show": "1", "refnr": ""},
+		Result: taskResult{Success: true, Result: "show"},
+		Failure: func(err error) taskResult {
+			return taskResult{Success: false, Result: "show failed"}
+		},
+	}
+	ruleTask := plannedTask{
+		Fields: params.Custom{"channel": "31543"},
+		Result: taskResult{Success: true, Result: "channel"},
+		Failure: func(err error) taskResult {
+			return taskResult{Success: false, Result: "channel failed"}
+		},
+	}
+	reportTask := resultOnlyTask(taskResult{Success: false, Result: "report"})
+	tests := []struct {
+		name  string
+		tasks []plannedTask
+		// Error hint of the first update, none if empty.
+		hint string
+		// Error of all updates.
+		err     error
+		updates []params.Custom
+		success []bool
+	}{
+		{
+			name:    "single update",
+			tasks:   []plannedTask{showTask, reportTask, ruleTask},
+			updates: []params.Custom{{"show": "1", "refnr": "", "channel": "31543"}},
+			success: []bool{true, false, true},
+		},
+		{
+			name:    "nothing to change",
+			tasks:   []plannedTask{reportTask},
+			success: []bool{false},
+		},
+		{
+			name:    "failed update",
+			tasks:   []plannedTask{showTask, reportTask, ruleTask},
+			err:     errors.New("unavailable"),
+			updates: []params.Custom{{"show": "1", "refnr": "", "channel": "31543"}},
+			success: []bool{false, false, false},
+		},
+		{
+			name:  "novalidcontext while linking the show",
+			tasks: []plannedTask{showTask, ruleTask},
+			hint:  "novalidcontext",
+			updates: []params.Custom{
+				{"show": "1", "refnr": "", "channel": "31543"},
+				{"refnr": "", "channel": "31543"},
+			},
+			success: []bool{true, true},
+		},
+		{
+			name:    "novalidcontext without show",
+			tasks:   []plannedTask{ruleTask},
+			hint:    "novalidcontext",
+			updates: []params.Custom{{"channel": "31543"}},
+			success: []bool{false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeOmnia()
+			u := newTestUpload(t, fake, notification.GeneralData{})
+			if tt.hint != "" {
+				u.Omnia = &hintOmnia{fakeOmnia: fake, hint: tt.hint}
+			}
+			if tt.err != nil {
+				fake.Errors["Update"] = tt.err
+			}
+			rsl := u.applyTasks(tt.tasks)
+			if len(rsl) != len(tt.success) {
+				t.Fatalf("%d results, want %d", len(rsl), len(tt.success))
+			}
+			for i, want := range tt.success {
+				if rsl[i].Success != want {
+					t.Errorf("result %d (%s) success is %t, want %t", i, rsl[i].Result, rsl[i].Success, want)
+				}
+			}
+			calls := fake.CallsOf("Update")
+			if len(calls) != len(tt.updates) {
+				t.Fatalf("%d updates, want %d", len(calls), len(tt.updates))
+			}
+			for i, want := range tt.updates {
+				if len(calls[i].Fields) != len(want) {
+					t.Errorf("update %d changed %v, want %v", i, calls[i].Fields, want)
+					continue
+				}
+				for field, value := range want {
+					if calls[i].Fields[field] != value {
+						t.Errorf("update %d changed %v, want %v", i, calls[i].Fields, want)
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestApplyTasksDryRun(t *testing.T) {
+	fake := newFakeOmnia()
+	u := newTestUpload(t, fake, notification.GeneralData{})
+	u.DryRun = true
+	rsl := u.applyTasks([]plannedTask{{
+		Fields: params.Custom{"channel": "31543"},
+		Result: taskResult{Success: true},
+	}})
+	if len(rsl) != 1 || !rsl[0].Success {
+		t.Errorf("results %v, want one successful result", rsl)
+	}
+	if calls := fake.CallsOf("Update"); len(calls) != 0 {
+		t.Errorf("%d updates in dry-run mode", len(calls))
+	}
+}
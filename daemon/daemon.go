@@ -1,24 +1,31 @@
 package daemon
 
 import (
+	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/alex-berlin-tv/nexx_omnia_go/notification"
 	"github.com/alex-berlin-tv/nexx_omnia_go/omnia"
 	"github.com/alex-berlin-tv/radio-ingest/config"
-	"github.com/alex-berlin-tv/radio-ingest/stackfield"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/sirupsen/logrus"
 	"go.etcd.io/bbolt"
 )
 
-// Handles a incoming request.
+// Number of notifications each worker buffers before new ones are rejected.
+const workerQueueSize = 32
+
+// Handles a incoming request. Handlers are created for each notification by
+// the [HandlerFactory] registered with [RegisterHandler].
 type Handler interface {
 	Name() string
 	Matches() bool
@@ -28,40 +35,193 @@ type Handler interface {
 // Listens to the Omnia's notification gateway and handles incoming radio
 // uploads.
 type Daemon struct {
-	Omnia      omnia.Omnia
-	Stackfield stackfield.Room
+	Omnia OmniaClient
+	// ID of the Omnia domain.
+	DomainId string
+	// Picks the notifiers for the messages of the handlers.
+	Router     Router
 	Port       int
 	recordPath string
 	DB         *bbolt.DB
+	Queue      RetryQueue
+	AdminToken string
+	// Number of workers processing notifications in the background.
+	Workers int
+	workers *workerPool
+	// Maximum time to wait for running handlers on shutdown.
+	ShutdownTimeout time.Duration
+	handlers        []enabledHandler
+	// Reports the intended changes of the handlers instead of applying them.
+	DryRun bool
+	// Secret expected in the trigger of incoming notifications.
+	NotificationSecret string
+	// Texts and templates of the messages.
+	Messages Messages
+	// Cached list of all shows.
+	Shows *ShowCatalog
+	// Broadcast schedules used by the handlers.
+	Schedules *ScheduleCache
+	// Serializes the processing of each item.
+	items *itemLocks
+}
+
+// Opens the bbolt DB at the given path. Only one process can open the DB at a
+// time, so a lock timeout usually means the daemon is running.
+func OpenDB(path string) (*bbolt.DB, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: 2 * time.Second})
+	if err == bbolt.ErrTimeout {
+		return nil, fmt.Errorf("failed to open DB %s, it's locked by another process (is the daemon running?)", path)
+	}
+	return db, err
 }
 
 // Returns a new [Daemon] instance based on the given configuration.
 func NewDaemon(cfg config.Config) (*Daemon, error) {
-	db, err := bbolt.Open(cfg.DBPath, 0600, &bbolt.Options{Timeout: 2 * time.Second})
+	db, err := OpenDB(cfg.DBPath)
+	if err != nil {
+		return nil, err
+	}
+	router, err := NewRouter(cfg.AllNotifiers(), cfg.Routes, cfg.FallbackNotifiers)
+	if err != nil {
+		return nil, err
+	}
+	if len(router.names) == 0 {
+		logrus.Warn("no notifiers configured, messages won't be delivered")
+	}
+	messages, err := NewMessages(cfg.Locale, cfg.Templates)
 	if err != nil {
 		return nil, err
 	}
-	return &Daemon{
-		Omnia:      omnia.NewOmnia(cfg.DomainId, cfg.ApiSecret, cfg.SessionId),
-		Stackfield: stackfield.NewRoom(cfg.StackfieldURL),
-		Port:       cfg.Port,
-		DB:         db,
-	}, nil
+	omniaClt := omnia.NewOmnia(cfg.DomainId, cfg.ApiSecret, cfg.SessionId)
+	shows, err := NewShowCatalog(omniaClt, db, time.Duration(cfg.ShowRefreshInterval)*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	handlers, err := enabledHandlers(cfg.Handlers)
+	if err != nil {
+		return nil, err
+	}
+	queue, err := NewRetryQueue(db, cfg.RetryMaxAttempts, time.Duration(cfg.RetryBaseDelay)*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	rsl := &Daemon{
+		Omnia:              omniaClt,
+		DomainId:           cfg.DomainId,
+		Router:             *router,
+		Port:               cfg.Port,
+		DB:                 db,
+		Queue:              *queue,
+		AdminToken:         cfg.AdminToken,
+		Workers:            cfg.Workers,
+		ShutdownTimeout:    time.Duration(cfg.ShutdownTimeout) * time.Second,
+		handlers:           handlers,
+		NotificationSecret: cfg.NotificationSecret,
+		Messages:           *messages,
+		Shows:              shows,
+		Schedules:          NewScheduleCache(),
+		items:              newItemLocks(),
+	}
+	rsl.Queue.GiveUp = rsl.onGiveUp
+	// Creating each handler once for an empty notification reveals invalid
+	// settings on startup instead of on the first notification. This also
+	// loads the schedules, so later notifications use the cached ones.
+	for _, enabled := range handlers {
+		if _, err := enabled.Factory(rsl.handlerEnv(enabled.Settings), Incoming{}); err != nil {
+			return nil, fmt.Errorf("failed to set up %s handler, %s", enabled.Name, err)
+		}
+	}
+	return rsl, nil
 }
 
 // Listen for notifications and writes them to a JSON file.
-func (d *Daemon) Record(path string) {
+func (d *Daemon) Record(path string) error {
 	d.recordPath = path
-	d.startRouter(d.recordHandler)
+	logrus.Infof("Will listen for Omnia on :%d", d.Port)
+	return http.ListenAndServe(fmt.Sprintf(":%d", d.Port), d.router(d.recordHandler))
 }
 
-// Run the daemon.
-func (d Daemon) Run() {
-	d.startRouter(d.defaultHandler)
+// Run the daemon. Uploads interrupted by a previous run are reset and
+// notifications left in the retry queue are processed before the daemon
+// starts listening. In dry-run mode the retry queue isn't used at all, as
+// the entries would be removed without being applied.
+//
+// On SIGINT or SIGTERM the daemon stops accepting requests and waits up to
+// the shutdown timeout for running handlers to finish. Notifications which
+// weren't started yet are moved to the retry queue right away. A signal
+// during the startup processing of the retry queue stops it after the current
+// entry. Afterwards the DB is closed.
+func (d Daemon) Run() error {
+	if d.NotificationSecret == "" {
+		logrus.Warn("no notification secret configured, incoming notifications are not verified")
+	}
+	if d.DryRun {
+		logrus.Info("dry-run mode, changes and messages are only printed, retry queue is disabled")
+		d.Shows.ReadOnly = true
+	} else if err := d.resetStaleUploads(); err != nil {
+		logrus.Errorf("failed to handle stale uploads, %s", err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	catalogDone := make(chan struct{})
+	go d.Shows.Run(catalogDone)
+	queueDone := make(chan struct{})
+	queueStopped := make(chan struct{})
+	if d.DryRun {
+		close(queueStopped)
+	} else {
+		d.Queue.Drain(d.onRetry, ctx.Done())
+		go func() {
+			d.Queue.Run(d.onRetry, queueDone)
+			close(queueStopped)
+		}()
+	}
+	d.workers = newWorkerPool(d.Workers, workerQueueSize, d.processInBackground, d.postponeNotification)
+	srv := http.Server{
+		Addr:    fmt.Sprintf(":%d", d.Port),
+		Handler: d.router(d.defaultHandler),
+	}
+	srvErr := make(chan error, 1)
+	go func() {
+		logrus.Infof("Will listen for Omnia on :%d", d.Port)
+		srvErr <- srv.ListenAndServe()
+	}()
+	var rsl error
+	select {
+	case err := <-srvErr:
+		rsl = err
+	case <-ctx.Done():
+		logrus.Infof("shutting down, waiting up to %s for running handlers", d.ShutdownTimeout)
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), d.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logrus.Errorf("failed to shut down http server, %s", err)
+	}
+	close(queueDone)
+	close(catalogDone)
+	done := make(chan struct{})
+	go func() {
+		d.workers.Close()
+		<-queueStopped
+		close(done)
+	}()
+	select {
+	case <-done:
+		logrus.Info("all handlers finished")
+	case <-shutdownCtx.Done():
+		logrus.Warn("shutdown timeout exceeded, running handlers will be interrupted")
+	}
+	if err := d.DB.Close(); err != nil {
+		logrus.Errorf("failed to close DB, %s", err)
+	}
+	return rsl
 }
 
 // Test the notification handling with a pre-recorded notification body. Takes
-// the path to the JSON file with the data as argument.
+// the path to the JSON file with the data as argument. In dry-run mode the
+// checks for outdated and already processed items are bypassed, so older
+// recordings can be replayed.
 //
 // Use the [Daemon.Record] method for record new notifications.
 func (d Daemon) TestRun(path string) error {
@@ -69,73 +229,212 @@ func (d Daemon) TestRun(path string) error {
 	if err != nil {
 		return err
 	}
-	return d.onNotification(dt)
+	d.Shows.ReadOnly = d.DryRun
+	_, err = d.dispatch(Incoming{Body: dt, Force: d.DryRun})
+	return err
 }
 
-func (d Daemon) startRouter(handler func(http.ResponseWriter, *http.Request)) {
+func (d Daemon) router(handler func(http.ResponseWriter, *http.Request)) http.Handler {
 	rtr := chi.NewRouter()
 	rtr.Use(middleware.Logger)
 	rtr.Post("/", handler)
-	logrus.Infof("Will listen for Omnia on :%d", d.Port)
-	http.ListenAndServe(fmt.Sprintf(":%d", d.Port), rtr)
+	rtr.With(d.requireAdminToken).Get("/items", d.listItemsHandler)
+	rtr.With(d.requireAdminToken).Get("/items/{id}", d.itemHandler)
+	rtr.With(d.requireAdminToken).Post("/items/{id}/reprocess", d.reprocessHandler)
+	rtr.With(d.requireAdminToken).Post("/shows/refresh", d.refreshShowsHandler)
+	rtr.Get("/aliases", d.listAliasesHandler)
+	rtr.With(d.requireAdminToken).Post("/aliases", d.addAliasHandler)
+	rtr.With(d.requireAdminToken).Delete("/aliases/{alias}", d.removeAliasHandler)
+	return rtr
 }
 
+// Validates an incoming notification and hands it to the worker pool. The
+// notification is acknowledged with 202 before it's processed. Malformed
+// bodies are answered with 400, a full worker pool with 503 so the Omnia
+// gateway can try again later.
 func (d Daemon) defaultHandler(w http.ResponseWriter, r *http.Request) {
 	dt, err := io.ReadAll(r.Body)
 	if err != nil {
 		logrus.Error(err)
+		http.Error(w, "failed to read body", http.StatusBadRequest)
 		return
 	}
-	if err := d.onNotification(dt); err != nil {
-		logrus.Error(err)
+	ntf, err := notification.NotificationFromJson(dt)
+	if err != nil {
+		logrus.Errorf("received malformed notification, %s", err)
+		http.Error(w, fmt.Sprintf("malformed notification, %s", err), http.StatusBadRequest)
+		return
+	}
+	if !d.verifySecret(*ntf) {
+		logrus.WithFields(debugFields(*ntf)).Warnf("rejected notification with invalid secret from %s", r.RemoteAddr)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !d.workers.Submit(job{Key: ntf.Item.ID, Body: dt}) {
+		logrus.WithFields(debugFields(*ntf)).Error("worker queue is full, notification rejected")
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "too many pending notifications", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Moves a notification which couldn't be started before the shutdown to the
+// retry queue. It will be processed on the next start.
+func (d Daemon) postponeNotification(body []byte) {
+	if d.DryRun {
+		logrus.Warn("dry-run mode, dropped notification which wasn't processed before the shutdown")
 		return
 	}
+	if err := d.Queue.Enqueue(body, fmt.Errorf("daemon was shut down before processing")); err != nil {
+		logrus.Errorf("failed to save pending notification, %s", err)
+	}
+}
+
+// Processes a notification within the worker pool. Failed notifications are
+// added to the retry queue, except in dry-run mode.
+func (d Daemon) processInBackground(body []byte) {
+	if err := d.onNotification(body); err != nil {
+		if d.DryRun {
+			logrus.Errorf("notification failed, %s", err)
+			return
+		}
+		logrus.Errorf("notification failed, added to retry queue, %s", err)
+		if err := d.Queue.Enqueue(body, err); err != nil {
+			logrus.Error(err)
+		}
+	}
 }
 
 func (d Daemon) recordHandler(w http.ResponseWriter, r *http.Request) {
 	dt, err := io.ReadAll(r.Body)
 	if err != nil {
 		logrus.Error(err)
+		http.Error(w, "failed to read body", http.StatusBadRequest)
 		return
 	}
 	var rec = make(Record)
 	if err := json.Unmarshal(dt, &rec); err != nil {
 		logrus.Error(err)
+		http.Error(w, fmt.Sprintf("malformed notification, %s", err), http.StatusBadRequest)
+		return
+	}
+	if err := rec.SaveToJson(d.recordPath); err != nil {
+		logrus.Error(err)
+		http.Error(w, "failed to save notification", http.StatusInternalServerError)
 		return
 	}
-	rec.SaveToJson(d.recordPath)
 	os.Exit(0)
 }
 
 func (d Daemon) onNotification(body []byte) error {
-	logrus.Trace(string(body))
-	ntf, err := notification.NotificationFromJson(body)
-	if err != nil {
-		return err
+	_, err := d.dispatch(Incoming{Body: body})
+	return err
+}
+
+// Processes a notification from the retry queue. Retries aren't subject to
+// the age checks of the handlers, as they may have waited in the queue for
+// a long time.
+func (d Daemon) onRetry(body []byte) error {
+	_, err := d.dispatch(Incoming{Body: body, Retry: true})
+	return err
+}
+
+// Sends an alert naming the item of a notification the retry queue gave up
+// on, so the editors can reprocess it by hand.
+func (d Daemon) onGiveUp(body []byte, cause error) {
+	itemID := "?"
+	if ntf, err := notification.NotificationFromJson(body); err == nil {
+		itemID = ntf.Item.ID
 	}
-	logrus.WithFields(debugFields(*ntf)).Info("new notification received")
-	radioHandler, err := NewRadioUpload(d.Omnia, d.Stackfield, d.DB, *ntf)
-	if err != nil {
-		return err
+	msg := d.Messages.Text("retry_abandoned", itemID, cause)
+	if err := d.Router.For(messageContext{HasErrors: true, HasManualTasks: true}).Send(msg); err != nil {
+		logrus.Errorf("failed to send alert for abandoned item %s, %s", itemID, err)
 	}
-	handlers := []Handler{
-		*radioHandler,
+}
+
+// Runs all enabled handlers matching the notification given by the body of
+// the incoming notification. Notifications for the same item are processed
+// one after another. Returns whether any handler was invoked.
+func (d Daemon) dispatch(in Incoming) (bool, error) {
+	logrus.Trace(string(in.Body))
+	ntf, err := notification.NotificationFromJson(in.Body)
+	if err != nil {
+		return false, err
 	}
+	logrus.WithFields(debugFields(*ntf)).Info("new notification received")
+	in.Notification = *ntf
+	unlock := d.items.Lock(ntf.Item.ID)
+	defer unlock()
 	handlersInvoked := false
-	for _, handler := range handlers {
+	for _, enabled := range d.handlers {
+		handler, err := enabled.Factory(d.handlerEnv(enabled.Settings), in)
+		if err != nil {
+			return handlersInvoked, fmt.Errorf("failed to create %s handler, %s", enabled.Name, err)
+		}
 		if handler.Matches() {
 			handlersInvoked = true
 			logrus.Infof("notification matches %s handler", handler.Name())
 			err := handler.OnNotification()
 			if err != nil {
-				return err
+				return handlersInvoked, err
 			}
 		}
 	}
 	if !handlersInvoked {
 		logrus.Info("no matching handlers for notifications, ignored")
 	}
-	return nil
+	return handlersInvoked, nil
+}
+
+func (d Daemon) handlerEnv(settings json.RawMessage) HandlerEnv {
+	return HandlerEnv{
+		Omnia:     d.Omnia,
+		Router:    d.Router,
+		DB:        d.DB,
+		DryRun:    d.DryRun,
+		Messages:  d.Messages,
+		Shows:     d.Shows,
+		Schedules: d.Schedules,
+		Settings:  settings,
+	}
+}
+
+// Checks the secret of a notification against the configured one. Always
+// true if no secret is configured.
+func (d Daemon) verifySecret(ntf notification.Notification) bool {
+	if d.NotificationSecret == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(ntf.Trigger.Secret), []byte(d.NotificationSecret)) == 1
+}
+
+// Returns the notification body without the secret of the trigger, so it can
+// be stored and exposed by the API. Bodies which aren't valid JSON are
+// returned unchanged.
+func withoutSecret(body []byte) []byte {
+	var ntf map[string]json.RawMessage
+	if err := json.Unmarshal(body, &ntf); err != nil {
+		return body
+	}
+	var trigger map[string]json.RawMessage
+	if err := json.Unmarshal(ntf["trigger"], &trigger); err != nil {
+		return body
+	}
+	if _, ok := trigger["secret"]; !ok {
+		return body
+	}
+	delete(trigger, "secret")
+	dt, err := json.Marshal(trigger)
+	if err != nil {
+		return body
+	}
+	ntf["trigger"] = dt
+	rsl, err := json.Marshal(ntf)
+	if err != nil {
+		return body
+	}
+	return rsl
 }
 
 func debugFields(ntf notification.Notification) logrus.Fields {
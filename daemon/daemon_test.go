@@ -0,0 +1,145 @@
+package daemon
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alex-berlin-tv/radio-ingest/config"
+)
+
+func TestWithoutSecret(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "secret",
+			body: `{"trigger":{"event":"metadata","secret":"s3cret"},"item":{"ID":"1"}}`,
+			want: `{"item":{"ID":"1"},"trigger":{"event":"metadata"}}`,
+		},
+		{
+			name: "no secret",
+			body: `{"trigger":{"event":"metadata"}}`,
+			want: `{"trigger":{"event":"metadata"}}`,
+		},
+		{
+			name: "no trigger",
+			body: `{"item":{"ID":"1"}}`,
+			want: `{"item":{"ID":"1"}}`,
+		},
+		{
+			name: "invalid",
+			body: `not json`,
+			want: `not json`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(withoutSecret([]byte(tt.body))); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestItemEndpointsRequireAdminToken(t *testing.T) {
+	db, err := OpenDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		status int
+	}{
+		{name: "no token configured", token: "", header: "", status: http.StatusForbidden},
+		{name: "missing token", token: "admin", header: "", status: http.StatusUnauthorized},
+		{name: "wrong token", token: "admin", header: "Bearer other", status: http.StatusUnauthorized},
+		{name: "valid token", token: "admin", header: "Bearer admin", status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := Daemon{DB: db, AdminToken: tt.token}
+			srv := httptest.NewServer(d.router(d.defaultHandler))
+			defer srv.Close()
+			for _, path := range []string{"/items", "/items/1"} {
+				req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tt.header != "" {
+					req.Header.Set("Authorization", tt.header)
+				}
+				rsp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				rsp.Body.Close()
+				want := tt.status
+				if want == http.StatusOK && strings.HasPrefix(path, "/items/") {
+					want = http.StatusNotFound
+				}
+				if rsp.StatusCode != want {
+					t.Errorf("GET %s answered %d, want %d", path, rsp.StatusCode, want)
+				}
+			}
+		})
+	}
+}
+
+func TestTestRunDryRunReplaysOldNotifications(t *testing.T) {
+	db, err := OpenDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	fake := newTestShows()
+	fake.AddItem(testItemID, map[string]any{"title": "Folge 12"})
+	shows, err := NewShowCatalog(fake, db, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlers, err := enabledHandlers([]config.HandlerConfig{{Name: "radio_upload", Enabled: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().AddDate(0, 0, -30).Unix()
+	path := filepath.Join(t.TempDir(), "notification.json")
+	body := fmt.Sprintf(`{
+		"trigger": {"event": "metadata", "created": %[1]d, "sent": %[1]d},
+		"item": {"ID": "4711", "GID": 1, "domain": 1, "streamtype": "audio"},
+		"data": {
+			"general": {"ID": 4711, "title": "Folge 12", "refnr": "Kiezradio", "created": %[1]d},
+			"publishingdata": {"origin": "uploadlink"}
+		}
+	}`, old)
+	if err := os.WriteFile(path, []byte(body), 0600); err != nil {
+		t.Fatal(err)
+	}
+	d := Daemon{
+		Omnia:    fake,
+		DB:       db,
+		DryRun:   true,
+		Messages: DefaultMessages(),
+		Shows:    shows,
+		handlers: handlers,
+	}
+	if err := d.TestRun(path); err != nil {
+		t.Fatal(err)
+	}
+	if calls := fake.CallsOf("All"); len(calls) == 0 {
+		t.Error("recorded notification wasn't handled")
+	}
+	if calls := fake.CallsOf("Update"); len(calls) != 0 {
+		t.Errorf("%d updates in dry-run mode", len(calls))
+	}
+}
@@ -0,0 +1,309 @@
+package daemon
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/markusmobius/go-dateparser"
+	"github.com/markusmobius/go-dateparser/date"
+)
+
+// Settings for extracting the broadcast date from the description.
+type DateSettings struct {
+	// Time zone the dates in the description are given in.
+	Timezone string `json:"timezone"`
+	// Allows dates before today.
+	AllowPast bool `json:"allow_past"`
+	// Dates more than this number of days ahead are not applied. No limit if
+	// zero.
+	MaxDaysAhead int `json:"max_days_ahead"`
+}
+
+// Returns the default settings for the date extraction.
+func DefaultDateSettings() DateSettings {
+	return DateSettings{
+		Timezone:     "Europe/Berlin",
+		AllowPast:    false,
+		MaxDaysAhead: 90,
+	}
+}
+
+// Checks for an unknown time zone and values out of range.
+func (s DateSettings) validate() error {
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return fmt.Errorf("invalid time zone %s, %s", s.Timezone, err)
+	}
+	if s.MaxDaysAhead < 0 {
+		return fmt.Errorf("max days ahead can't be negative")
+	}
+	return nil
+}
+
+// Returns the time zone of the settings, falls back to UTC.
+func (s DateSettings) location() *time.Location {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Returns the earliest and latest allowed date relative to now. A zero time
+// means there is no limit.
+func (s DateSettings) window(now time.Time) (time.Time, time.Time) {
+	var from, to time.Time
+	today := startOfDay(now)
+	if !s.AllowPast {
+		from = today
+	}
+	if s.MaxDaysAhead > 0 {
+		to = today.AddDate(0, 0, s.MaxDaysAhead+1).Add(-time.Nanosecond)
+	}
+	return from, to
+}
+
+// Formats the window for messages.
+func formatWindow(from time.Time, to time.Time) string {
+	switch {
+	case from.IsZero() && to.IsZero():
+		return "-"
+	case from.IsZero():
+		return fmt.Sprintf("– %s", to.Format("02.01.2006"))
+	case to.IsZero():
+		return fmt.Sprintf("%s –", from.Format("02.01.2006"))
+	}
+	return fmt.Sprintf("%s – %s", from.Format("02.01.2006"), to.Format("02.01.2006"))
+}
+
+// A date found in a text.
+type dateCandidate struct {
+	// Part of the text the date was found in.
+	Text string    `json:"text"`
+	Date time.Time `json:"date"`
+	// States whether the text contained a time of day.
+	HasTime bool `json:"has_time"`
+	// Set if the date wasn't given by the uploader but derived from the
+	// schedule.
+	Inferred bool `json:"inferred,omitempty"`
+	// Position in the text, used to keep the order of the text.
+	index int
+}
+
+// Formats the date with the time of day if given.
+func (c dateCandidate) String() string {
+	if c.HasTime {
+		return c.Date.Format("02.01.2006 15:04")
+	}
+	return c.Date.Format("02.01.2006")
+}
+
+// Returns the candidates as a comma separated list.
+func formatDates(candidates []dateCandidate) string {
+	var rsl []string
+	for _, candidate := range candidates {
+		rsl = append(rsl, candidate.String())
+	}
+	return strings.Join(rsl, ", ")
+}
+
+// States whether the date lies within the given window.
+func (c dateCandidate) within(from time.Time, to time.Time) bool {
+	if !from.IsZero() && c.Date.Before(from) {
+		return false
+	}
+	return to.IsZero() || !c.Date.After(to)
+}
+
+var (
+	// "18 Uhr", "18.30 Uhr" or "18:30 Uhr".
+	hourPattern = regexp.MustCompile(`(?i)\b(\d{1,2})(?:[.:](\d{2}))?\s*uhr\b`)
+	// "24.12.2026", "24.12.26" or "24.12." optionally followed by a time
+	// like ", um 18:30".
+	numericDatePattern = regexp.MustCompile(`(?i)\b(\d{1,2})\.(\d{1,2})\.(\d{4}|\d{2})?(?:,?\s*(?:um\s+)?(\d{1,2}):(\d{2}))?`)
+	// "Dienstag" or "nächsten Dienstag" optionally followed by a time.
+	weekdayPattern = regexp.MustCompile(`(?i)\b(?:(nächste[nrs]?|kommende[nrs]?)\s+)?(montag|dienstag|mittwoch|donnerstag|freitag|samstag|sonntag)\b(?:,?\s*(?:um\s+)?(\d{1,2}):(\d{2}))?`)
+	// Numeric date following a weekday.
+	dateAfterWeekday = regexp.MustCompile(`^,?\s*(?:den\s+)?\d{1,2}\.\d{1,2}\.`)
+)
+
+var germanWeekdays = map[string]time.Weekday{
+	"montag":     time.Monday,
+	"dienstag":   time.Tuesday,
+	"mittwoch":   time.Wednesday,
+	"donnerstag": time.Thursday,
+	"freitag":    time.Friday,
+	"samstag":    time.Saturday,
+	"sonntag":    time.Sunday,
+}
+
+// Returns all dates in a German text in the order they appear. Numeric dates
+// (with day first) and weekdays are parsed directly, the remaining text is
+// searched for dates written in words like "3. November" or "morgen".
+func extractDates(text string, now time.Time) []dateCandidate {
+	loc := now.Location()
+	text = hourPattern.ReplaceAllStringFunc(text, func(s string) string {
+		m := hourPattern.FindStringSubmatch(s)
+		if m[2] == "" {
+			return fmt.Sprintf("%s:00", m[1])
+		}
+		return fmt.Sprintf("%s:%s", m[1], m[2])
+	})
+	var rsl []dateCandidate
+	// Parsed parts are blanked so the search for dates in words doesn't
+	// find them again.
+	rest := []byte(text)
+	blank := func(start, end int) {
+		for i := start; i < end; i++ {
+			rest[i] = ' '
+		}
+	}
+	for _, m := range numericDatePattern.FindAllStringSubmatchIndex(text, -1) {
+		day, _ := strconv.Atoi(text[m[2]:m[3]])
+		month, _ := strconv.Atoi(text[m[4]:m[5]])
+		year := 0
+		if m[6] != -1 {
+			year, _ = strconv.Atoi(text[m[6]:m[7]])
+			if year < 100 {
+				year += 2000
+			}
+		}
+		hour, minute, hasTime := submatchTime(text, m[8:12])
+		date, ok := buildDate(year, time.Month(month), day, hour, minute, now)
+		if !ok {
+			continue
+		}
+		rsl = append(rsl, dateCandidate{
+			Text:    strings.TrimSpace(text[m[0]:m[1]]),
+			Date:    date,
+			HasTime: hasTime,
+			index:   m[0],
+		})
+		blank(m[0], m[1])
+	}
+	for _, m := range weekdayPattern.FindAllStringSubmatchIndex(text, -1) {
+		if dateAfterWeekday.MatchString(text[m[5]:]) {
+			// The date is given explicitly, only the weekday is dropped.
+			blank(m[0], m[5])
+			continue
+		}
+		weekday := germanWeekdays[strings.ToLower(text[m[4]:m[5]])]
+		days := (int(weekday) - int(now.Weekday()) + 7) % 7
+		if m[2] != -1 && days == 0 {
+			// "nächsten Montag" on a monday refers to the following week.
+			days = 7
+		}
+		hour, minute, hasTime := submatchTime(text, m[6:10])
+		day := startOfDay(now).AddDate(0, 0, days)
+		rsl = append(rsl, dateCandidate{
+			Text:    strings.TrimSpace(text[m[0]:m[1]]),
+			Date:    time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, loc),
+			HasTime: hasTime,
+			index:   m[0],
+		})
+		blank(m[0], m[1])
+	}
+	rsl = append(rsl, searchWordDates(string(rest), now)...)
+	sort.SliceStable(rsl, func(i, j int) bool {
+		return rsl[i].index < rsl[j].index
+	})
+	return rsl
+}
+
+// Returns the hour and minute of the given submatch indices of a time.
+func submatchTime(text string, m []int) (int, int, bool) {
+	if m[0] == -1 {
+		return 0, 0, false
+	}
+	hour, _ := strconv.Atoi(text[m[0]:m[1]])
+	minute, _ := strconv.Atoi(text[m[2]:m[3]])
+	if hour > 23 || minute > 59 {
+		return 0, 0, false
+	}
+	return hour, minute, true
+}
+
+// Returns the date for the given values. Without a year the next occurrence
+// of the day is used. Fails for invalid dates like the 31st of April.
+func buildDate(year int, month time.Month, day int, hour int, minute int, now time.Time) (time.Time, bool) {
+	explicitYear := year != 0
+	if !explicitYear {
+		year = now.Year()
+	}
+	rsl := time.Date(year, month, day, hour, minute, 0, 0, now.Location())
+	if rsl.Day() != day || rsl.Month() != month {
+		return time.Time{}, false
+	}
+	if !explicitYear && rsl.Before(startOfDay(now)) {
+		rsl = rsl.AddDate(1, 0, 0)
+	}
+	return rsl, true
+}
+
+// Searches the text for dates written in words using dateparser.
+func searchWordDates(text string, now time.Time) []dateCandidate {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	cfg := dateparser.Configuration{
+		DateOrder:           dateparser.DMY,
+		Languages:           []string{"de"},
+		CurrentTime:         now,
+		PreferredDateSource: dateparser.Future,
+		ReturnTimeAsPeriod:  true,
+	}
+	_, found, err := dateparser.Search(&cfg, text)
+	if err != nil {
+		return nil
+	}
+	var rsl []dateCandidate
+	offset := 0
+	for _, item := range found {
+		if !hasDateWord(item.Text) {
+			// Numeric dates are parsed by extractDates, dateparser mistakes
+			// the remaining numbers for times of day.
+			continue
+		}
+		index := strings.Index(text[offset:], item.Text)
+		if index == -1 {
+			index = 0
+		}
+		index += offset
+		offset = index + len(item.Text)
+		candidate := dateCandidate{
+			Text:    strings.TrimSpace(item.Text),
+			Date:    item.Date.Time.In(now.Location()),
+			HasTime: item.Date.Period == date.Time,
+			index:   index,
+		}
+		if !candidate.HasTime {
+			candidate.Date = startOfDay(candidate.Date)
+		}
+		rsl = append(rsl, candidate)
+	}
+	return rsl
+}
+
+// States whether the text contains a word other than the filler words
+// around a time. Otherwise dateparser interpreted plain numbers.
+func hasDateWord(text string) bool {
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		switch word {
+		case "am", "pm", "um", "uhr":
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// Returns midnight of the day in the location of the time.
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
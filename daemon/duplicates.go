@@ -0,0 +1,228 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.etcd.io/bbolt"
+)
+
+const uploadIndexBucket = "UploadIndex"
+
+// Prefixes of the keys in the upload index.
+const (
+	// Items by the hash of their audio.
+	audioIndexPrefix = "audio/"
+	// Items by show and normalized title.
+	metaIndexPrefix = "meta/"
+	// Keys under which an item is indexed, used to remove outdated entries
+	// when the item is processed again.
+	itemIndexPrefix = "item/"
+)
+
+// An indexed upload, used to find duplicates.
+type uploadRef struct {
+	ItemID      string     `json:"item_id"`
+	Title       string     `json:"title"`
+	Show        string     `json:"show,omitempty"`
+	ReleaseDate *time.Time `json:"release_date,omitempty"`
+	Received    time.Time  `json:"received"`
+	// Reason the upload is considered a duplicate, either audio or metadata.
+	Match string `json:"match,omitempty"`
+}
+
+// States whether both uploads have the same release date. Uploads without
+// date never match, as generic titles would be reported all the time.
+func (r uploadRef) sameDate(other uploadRef) bool {
+	if r.ReleaseDate == nil || other.ReleaseDate == nil {
+		return false
+	}
+	return r.ReleaseDate.Equal(*other.ReleaseDate)
+}
+
+// States whether the upload was received before the other one.
+func (r uploadRef) before(other uploadRef) bool {
+	if r.Received.Equal(other.Received) {
+		return r.ItemID < other.ItemID
+	}
+	return r.Received.Before(other.Received)
+}
+
+// Returns the keys the upload is indexed under. Uploads without linked show
+// are only indexed by their audio.
+func uploadIndexKeys(showID int, title string, audioHash string) []string {
+	var rsl []string
+	if audioHash != "" {
+		rsl = append(rsl, audioIndexPrefix+audioHash)
+	}
+	if normalized := normalizeShowName(title); showID != 0 && normalized != "" {
+		rsl = append(rsl, fmt.Sprintf("%s%d/%s", metaIndexPrefix, showID, normalized))
+	}
+	return rsl
+}
+
+// Returns the uploads received before the given one with the same audio or
+// with the same show, title and release date. The earliest upload comes
+// first.
+func findDuplicates(db *bbolt.DB, ref uploadRef, keys []string) ([]uploadRef, error) {
+	var rsl []uploadRef
+	err := db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(uploadIndexBucket))
+		if bucket == nil {
+			return nil
+		}
+		found := map[string]bool{}
+		for _, key := range keys {
+			refs, err := indexEntries(bucket, key)
+			if err != nil {
+				return err
+			}
+			isAudio := strings.HasPrefix(key, audioIndexPrefix)
+			for _, other := range refs {
+				if other.ItemID == ref.ItemID || found[other.ItemID] || !other.before(ref) {
+					continue
+				}
+				if isAudio {
+					other.Match = "audio"
+				} else if ref.sameDate(other) {
+					other.Match = "metadata"
+				} else {
+					continue
+				}
+				found[other.ItemID] = true
+				rsl = append(rsl, other)
+			}
+		}
+		return nil
+	})
+	sort.SliceStable(rsl, func(i, j int) bool {
+		return rsl[i].before(rsl[j])
+	})
+	return rsl, err
+}
+
+// Indexes the upload under the given keys. Entries of a previous run for the
+// same item are replaced.
+func indexUpload(db *bbolt.DB, ref uploadRef, keys []string) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(uploadIndexBucket))
+		if err != nil {
+			return err
+		}
+		itemKey := []byte(itemIndexPrefix + ref.ItemID)
+		if dt := bucket.Get(itemKey); dt != nil {
+			var previous []string
+			if err := json.Unmarshal(dt, &previous); err != nil {
+				return fmt.Errorf("invalid upload index of item %s, %s", ref.ItemID, err)
+			}
+			for _, key := range previous {
+				if err := removeIndexEntry(bucket, key, ref.ItemID); err != nil {
+					return err
+				}
+			}
+		}
+		for _, key := range keys {
+			refs, err := indexEntries(bucket, key)
+			if err != nil {
+				return err
+			}
+			if err := putIndexEntries(bucket, key, append(refs, ref)); err != nil {
+				return err
+			}
+		}
+		dt, err := json.Marshal(keys)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(itemKey, dt)
+	})
+}
+
+// Returns the uploads stored under the key.
+func indexEntries(bucket *bbolt.Bucket, key string) ([]uploadRef, error) {
+	dt := bucket.Get([]byte(key))
+	if dt == nil {
+		return nil, nil
+	}
+	var rsl []uploadRef
+	if err := json.Unmarshal(dt, &rsl); err != nil {
+		return nil, fmt.Errorf("invalid upload index entry %s, %s", key, err)
+	}
+	return rsl, nil
+}
+
+// Stores the uploads under the key, deletes the key if there are none.
+func putIndexEntries(bucket *bbolt.Bucket, key string, refs []uploadRef) error {
+	if len(refs) == 0 {
+		return bucket.Delete([]byte(key))
+	}
+	dt, err := json.Marshal(refs)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(key), dt)
+}
+
+// Removes the item from the uploads stored under the key.
+func removeIndexEntry(bucket *bbolt.Bucket, key string, itemID string) error {
+	refs, err := indexEntries(bucket, key)
+	if err != nil {
+		return err
+	}
+	var rsl []uploadRef
+	for _, ref := range refs {
+		if ref.ItemID != itemID {
+			rsl = append(rsl, ref)
+		}
+	}
+	return putIndexEntries(bucket, key, rsl)
+}
+
+// Looks up earlier uploads of the same episode and indexes the item. Returns
+// false if no duplicate was found. The index isn't touched in dry-run mode.
+func (u RadioUpload) checkDuplicates(rec *ProcessingRecord, analysis *audioAnalysis) (plannedTask, bool) {
+	ref := uploadRef{
+		ItemID:      rec.ItemID,
+		Title:       rec.Title,
+		Show:        rec.Show,
+		ReleaseDate: rec.ReleaseDate,
+		Received:    rec.Received,
+	}
+	var audioHash string
+	if analysis != nil {
+		audioHash = analysis.Hash
+	}
+	keys := uploadIndexKeys(rec.ShowID, rec.Title, audioHash)
+	duplicates, err := findDuplicates(u.DB, ref, keys)
+	if err != nil {
+		logrus.Error(err)
+	}
+	if !u.DryRun {
+		if err := indexUpload(u.DB, ref, keys); err != nil {
+			logrus.Error(err)
+		}
+	}
+	if len(duplicates) == 0 {
+		return plannedTask{}, false
+	}
+	earliest := duplicates[0]
+	manualTasks := []string{u.Messages.Text("duplicate_task", earliest.ItemID)}
+	if len(duplicates) > 1 {
+		var others []string
+		for _, other := range duplicates[1:] {
+			others = append(others, other.ItemID)
+		}
+		manualTasks = append(manualTasks, u.Messages.Text("duplicate_others", strings.Join(others, ", ")))
+	}
+	return resultOnlyTask(taskResult{
+		Success:     false,
+		Omit:        false,
+		Result:      u.Messages.Text("duplicate_"+earliest.Match, earliest.ItemID, earliest.Title, earliest.Received.Format("02.01.2006 15:04")),
+		ManualTasks: manualTasks,
+		Duplicates:  duplicates,
+	}), true
+}
@@ -0,0 +1,80 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alex-berlin-tv/nexx_omnia_go/notification"
+)
+
+func TestCheckDuplicates(t *testing.T) {
+	date := time.Date(2026, 10, 20, 18, 0, 0, 0, time.UTC)
+	otherDate := date.AddDate(0, 0, 7)
+	received := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	// Upload already in the index.
+	earlier := ProcessingRecord{
+		ItemID:      "1",
+		Title:       "Folge 12",
+		ShowID:      1,
+		ReleaseDate: &date,
+		Received:    received,
+	}
+	tests := []struct {
+		name  string
+		rec   ProcessingRecord
+		audio string
+		match string
+	}{
+		{
+			name:  "same metadata",
+			rec:   ProcessingRecord{Title: "folge 12!", ShowID: 1, ReleaseDate: &date},
+			match: "metadata",
+		},
+		{
+			name: "other date",
+			rec:  ProcessingRecord{Title: "Folge 12", ShowID: 1, ReleaseDate: &otherDate},
+		},
+		{
+			name: "missing date",
+			rec:  ProcessingRecord{Title: "Folge 12", ShowID: 1},
+		},
+		{
+			name: "other show",
+			rec:  ProcessingRecord{Title: "Folge 12", ShowID: 2, ReleaseDate: &date},
+		},
+		{
+			name:  "same audio",
+			rec:   ProcessingRecord{Title: "Anderer Titel", ShowID: 2},
+			audio: "abc",
+			match: "audio",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := newTestUpload(t, newFakeOmnia(), notification.GeneralData{})
+			if _, ok := u.checkDuplicates(&earlier, &audioAnalysis{Hash: "abc"}); ok {
+				t.Fatal("first upload reported as duplicate")
+			}
+			rec := tt.rec
+			rec.ItemID = "2"
+			rec.Received = received.Add(time.Hour)
+			var analysis *audioAnalysis
+			if tt.audio != "" {
+				analysis = &audioAnalysis{Hash: tt.audio}
+			}
+			task, ok := u.checkDuplicates(&rec, analysis)
+			if ok != (tt.match != "") {
+				t.Fatalf("duplicate reported %t, want %t: %s", ok, tt.match != "", task.Result.Result)
+			}
+			if !ok {
+				return
+			}
+			if len(task.Result.Duplicates) != 1 {
+				t.Fatalf("duplicates %v, want item 1", task.Result.Duplicates)
+			}
+			if got := task.Result.Duplicates[0]; got.ItemID != "1" || got.Match != tt.match {
+				t.Errorf("duplicate %s matched by %s, want item 1 matched by %s", got.ItemID, got.Match, tt.match)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package daemon
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/alex-berlin-tv/radio-ingest/notifier"
+	"go.etcd.io/bbolt"
+)
+
+// Version of the [ProcessingRecord] format. Increase on breaking changes.
+const processingRecordVersion = 1
+
+const (
+	statusProcessing = "processing"
+	statusDone       = "done"
+	statusFailed     = "failed"
+)
+
+// Persisted information on the processing of a single item. Allows to audit
+// what the daemon did to an item long after the fact. Records are stored as
+// JSON in the RadioUpload bucket using the item ID as key.
+type ProcessingRecord struct {
+	// Version of the record format. Entries written before the introduction of
+	// records only contain the status and are reported as version 0.
+	Version int    `json:"version"`
+	ItemID  string `json:"item_id"`
+	// One of processing, done or failed.
+	Status string `json:"status"`
+	// Title of the item as given by the uploader.
+	Title string `json:"title,omitempty"`
+	// ID and title of the show matched for the item.
+	ShowID int    `json:"show_id,omitempty"`
+	Show   string `json:"show,omitempty"`
+	// Producer as given by the uploader in the subtitle. Kept for routing
+	// the message, as the subtitle is cleared by the first run.
+	Producer string `json:"producer,omitempty"`
+	// Release date set for the item.
+	ReleaseDate *time.Time `json:"release_date,omitempty"`
+	// Time the first notification for the item was received.
+	Received time.Time `json:"received"`
+	// Time of the last change to the record.
+	Updated time.Time `json:"updated"`
+	// Body of the last notification which triggered the processing, without
+	// the secret of the trigger.
+	Notification json.RawMessage `json:"notification,omitempty"`
+	// Analysis of the uploaded audio, reused while the file doesn't change.
+	Audio *cachedAudio `json:"audio,omitempty"`
+	// Outcome of all tasks of the last run.
+	Results taskResults `json:"results"`
+	// Rendered message of the last run.
+	Message string `json:"message,omitempty"`
+	// Notifiers which received the message, so a retry only sends it to the
+	// remaining ones.
+	Delivery notifier.Delivery `json:"delivery,omitempty"`
+	// States whether the message was sent to the notifiers.
+	MessageSent bool `json:"message_sent"`
+	// Error which occurred while sending the message.
+	MessageError string `json:"message_error,omitempty"`
+	// Number of times the item was processed.
+	Attempts int `json:"attempts"`
+}
+
+// Returns a new [ProcessingRecord] for the given item.
+func NewProcessingRecord(itemID string) ProcessingRecord {
+	now := time.Now()
+	return ProcessingRecord{
+		Version:  processingRecordVersion,
+		ItemID:   itemID,
+		Received: now,
+		Updated:  now,
+	}
+}
+
+// Decodes a record as stored in the DB. Handles legacy entries which only
+// consist of the status string.
+func processingRecordFromBytes(itemID string, dt []byte) (*ProcessingRecord, error) {
+	if len(dt) > 0 && dt[0] != '{' {
+		return &ProcessingRecord{
+			Version: 0,
+			ItemID:  itemID,
+			Status:  string(dt),
+		}, nil
+	}
+	var rsl ProcessingRecord
+	if err := json.Unmarshal(dt, &rsl); err != nil {
+		return nil, err
+	}
+	return &rsl, nil
+}
+
+// Loads the record of an item. Returns nil if there is no record for the item.
+func loadProcessingRecord(db *bbolt.DB, itemID string) (*ProcessingRecord, error) {
+	var rsl *ProcessingRecord
+	err := db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(radioUploadBucket))
+		if bucket == nil {
+			return nil
+		}
+		value := bucket.Get([]byte(itemID))
+		if len(value) == 0 {
+			return nil
+		}
+		var err error
+		rsl, err = processingRecordFromBytes(itemID, value)
+		return err
+	})
+	return rsl, err
+}
+
+// Saves the record to the DB, updates the timestamp and upgrades the record
+// to the current version.
+func (r *ProcessingRecord) save(db *bbolt.DB) error {
+	r.Version = processingRecordVersion
+	r.Updated = time.Now()
+	dt, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(radioUploadBucket)).Put([]byte(r.ItemID), dt)
+	})
+}
+
+// Picks a release date for the item based on the release dates of all other
+// records of the show. With reserve the date is stored in the record of the
+// item within the same transaction, so concurrent workers can't pick the same
+// date. Returns false if pick found no date.
+func reserveReleaseDate(db *bbolt.DB, showID int, itemID string, reserve bool, pick func(taken []time.Time) (time.Time, bool)) (time.Time, bool, error) {
+	var rsl time.Time
+	var ok bool
+	fn := func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(radioUploadBucket))
+		if bucket == nil {
+			rsl, ok = pick(nil)
+			return nil
+		}
+		taken, err := showReleaseDates(bucket, showID, itemID)
+		if err != nil {
+			return err
+		}
+		rsl, ok = pick(taken)
+		if !ok || !reserve {
+			return nil
+		}
+		rec := NewProcessingRecord(itemID)
+		if dt := bucket.Get([]byte(itemID)); len(dt) != 0 {
+			existing, err := processingRecordFromBytes(itemID, dt)
+			if err != nil {
+				return err
+			}
+			rec = *existing
+		}
+		rec.ShowID = showID
+		rec.ReleaseDate = &rsl
+		rec.Version = processingRecordVersion
+		rec.Updated = time.Now()
+		dt, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(itemID), dt)
+	}
+	var err error
+	if reserve {
+		err = db.Update(fn)
+	} else {
+		err = db.View(fn)
+	}
+	return rsl, ok, err
+}
+
+// Returns the release dates of all records of the given show except the one
+// of the given item.
+func showReleaseDates(bucket *bbolt.Bucket, showID int, exceptItemID string) ([]time.Time, error) {
+	var rsl []time.Time
+	err := bucket.ForEach(func(k, v []byte) error {
+		if string(k) == exceptItemID {
+			return nil
+		}
+		rec, err := processingRecordFromBytes(string(k), v)
+		if err != nil {
+			return nil
+		}
+		if rec.ShowID == showID && rec.ReleaseDate != nil {
+			rsl = append(rsl, *rec.ReleaseDate)
+		}
+		return nil
+	})
+	return rsl, err
+}
@@ -0,0 +1,351 @@
+package daemon
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"text/template"
+
+	"github.com/alex-berlin-tv/nexx_omnia_go/notification"
+	"github.com/alex-berlin-tv/radio-ingest/config"
+)
+
+// Locale used if none is configured and as fallback for missing texts.
+const defaultLocale = "de"
+
+// Texts of the task results and manual tasks by locale and message ID. The
+// texts are format strings for [fmt.Sprintf].
+var messageCatalog = map[string]map[string]string{
+	"de": {
+		"show_not_found":         "Für den angegebenen Sendungsnamen '%s' konnte keine Sendung gefunden werden",
+		"show_not_found_task":    "Passende Sendung für '%s' finden und entsprechend setzen",
+		"show_linked":            "Wurde der Sendung %s zugeordnet",
+		"show_linked_alias":      "Wurde über den Alias '%[2]s' der Sendung '%[1]s' zugeordnet",
+		"show_alternatives":      "Alternativen: %s",
+		"show_candidates":        "Ähnliche Sendungen: %s",
+		"show_ambiguous":         "Der Sendungsname '%s' passt auf mehrere Sendungen: %s",
+		"show_ambiguous_task":    "Richtige Sendung für '%s' auswählen und setzen",
+		"show_link_failed":       "Beitrag konnte nicht mit Sendung '%s' verknüpft werden, %s",
+		"show_link_task":         "Mit Sendung '%s' verbinden",
+		"clear_refnr_task":       "Inhalt des Felds Referenznummer löschen",
+		"date_not_found":         "Das Sendedatum konnte nicht aus dem Beschreibungsfeld entnommen werden",
+		"date_not_found_task":    "Das Sendedatum setzen",
+		"date_set":               "Veröffentlichungsdatum wurde auf %s gesetzt",
+		"date_failed":            "Veröffentlichungsdatum konnte nicht gesetzt werden, %s",
+		"date_task":              "Veröffentlichungsdatum auf %s setzen",
+		"date_out_of_window":     "Das angegebene Sendedatum %s liegt außerhalb des erlaubten Zeitraums (%s) und wurde nicht übernommen",
+		"date_check_task":        "Sendedatum %s prüfen und Veröffentlichungsdatum setzen",
+		"date_candidates":        "Weitere Termine in der Beschreibung prüfen: %s",
+		"date_in_schedule":       "Das Sendedatum %s passt zum Sendeplan",
+		"date_not_in_schedule":   "Das Sendedatum %s passt zu keinem Sendeplatz der Sendung '%s'",
+		"date_slot_task":         "Veröffentlichungsdatum prüfen, der nächstgelegene Sendeplatz ist am %s",
+		"date_proposed_task":     "Veröffentlichungsdatum setzen, laut Sendeplan ist der nächste freie Sendeplatz am %s",
+		"date_inferred":          "Veröffentlichungsdatum wurde aus dem Sendeplan abgeleitet und auf den nächsten freien Sendeplatz am %s gesetzt",
+		"date_confirm_task":      "Aus dem Sendeplan abgeleitetes Veröffentlichungsdatum %s bestätigen",
+		"audio_ok":               "Die Audiodatei entspricht den technischen Vorgaben",
+		"audio_check_failed":     "Die Audiodatei konnte nicht technisch geprüft werden, %s",
+		"audio_check_task":       "Audiodatei vor der Ausstrahlung anhören und technisch prüfen",
+		"audio_duration":         "Die Länge der Audiodatei (%s) weicht von der Länge des Sendeplatzes (%s) ab",
+		"audio_duration_task":    "Audiodatei an die Länge des Sendeplatzes von %s anpassen",
+		"audio_loudness":         "Die Lautheit der Audiodatei beträgt %.1f LUFS statt %.1f LUFS",
+		"audio_loudness_task":    "Audiodatei auf %.1f LUFS normalisieren",
+		"audio_true_peak":        "Der True Peak der Audiodatei liegt mit %.1f dBTP über %.1f dBTP",
+		"audio_true_peak_task":   "Audiodatei so limitieren, dass der True Peak %.1f dBTP nicht übersteigt",
+		"audio_sample_rate":      "Die Audiodatei hat eine Abtastrate von %d Hz, erlaubt sind %s Hz",
+		"audio_channels":         "Die Audiodatei hat %d Kanäle, erlaubt sind %s",
+		"audio_format_task":      "Audiodatei im vorgegebenen Format neu exportieren",
+		"audio_leading_silence":  "Die Audiodatei beginnt mit %.1f Sekunden Stille",
+		"audio_trailing_silence": "Die Audiodatei endet mit %.1f Sekunden Stille",
+		"audio_silence_task":     "Stille am Anfang und Ende der Audiodatei entfernen",
+		"duplicate_audio":        "Die Audiodatei ist identisch mit der des Beitrags %s ('%s', hochgeladen am %s)",
+		"duplicate_metadata":     "Titel, Sendung und Sendedatum stimmen mit dem Beitrag %s ('%s', hochgeladen am %s) überein",
+		"duplicate_task":         "Prüfen, ob der Beitrag ein Duplikat von %s ist, und gegebenenfalls einen der beiden löschen",
+		"duplicate_others":       "Weitere mögliche Duplikate: %s",
+		"channel_set":            "Channel wurde auf Radio gesetzt",
+		"channel_failed":         "Channel konnte nicht auf Radio gesetzt werden",
+		"channel_task":           "Channel auf Radio setzten",
+		"subtitle_moved":         "Inhalt aus dem Feld »Untertitel« nach »Alternativer Titel« übertragen",
+		"subtitle_failed":        "Produzent:innen konnten nicht in das Feld »Alternativer Titel« übertragen werden",
+		"subtitle_task":          "Produzent:innen in das Feld »Alternativer Titel« übertragen",
+		"clear_subtitle_task":    "Inhalt des Felds »Untertitel« löschen",
+		"description_moved":      "Inhalt aus dem Feld »Beschreibung« nach »Alternative Beschreibung« übertragen",
+		"description_failed":     "Angaben aus dem Feld »Beschreibung« konnten nicht in das Feld »Alternative Beschreibung« übertragen werden",
+		"description_task":       "Inhalt von »Beschreibung« nach »Alternative Beschreibung« übertragen",
+		"clear_description_task": "Inhalt des Felds »Beschreibung« löschen",
+		"source_empty":           "Das Feld %s ist leer, es wurde nichts übertragen",
+		"retry_abandoned":        "Das Item %s konnte auch nach mehreren Versuchen nicht verarbeitet werden (%s). Bitte mit `radio-ingest reprocess --id %[1]s` oder `POST /items/%[1]s/reprocess` erneut verarbeiten.",
+	},
+	"en": {
+		"show_not_found":         "No show could be found for the given show name '%s'",
+		"show_not_found_task":    "Find the matching show for '%s' and set it",
+		"show_linked":            "Linked to the show %s",
+		"show_linked_alias":      "Linked to the show '%s' using the alias '%s'",
+		"show_alternatives":      "alternatives: %s",
+		"show_candidates":        "Similar shows: %s",
+		"show_ambiguous":         "The show name '%s' matches multiple shows: %s",
+		"show_ambiguous_task":    "Choose the correct show for '%s' and set it",
+		"show_link_failed":       "Item couldn't be linked to the show '%s', %s",
+		"show_link_task":         "Link to the show '%s'",
+		"clear_refnr_task":       "Clear the reference number field",
+		"date_not_found":         "The broadcast date couldn't be taken from the description field",
+		"date_not_found_task":    "Set the broadcast date",
+		"date_set":               "Release date was set to %s",
+		"date_failed":            "Release date couldn't be set, %s",
+		"date_task":              "Set the release date to %s",
+		"date_out_of_window":     "The given broadcast date %s is outside of the allowed period (%s) and wasn't applied",
+		"date_check_task":        "Check the broadcast date %s and set the release date",
+		"date_candidates":        "Check further dates in the description: %s",
+		"date_in_schedule":       "The broadcast date %s fits the schedule",
+		"date_not_in_schedule":   "The broadcast date %s doesn't fit any slot of the show '%s'",
+		"date_slot_task":         "Check the release date, the nearest slot is on %s",
+		"date_proposed_task":     "Set the release date, the next free slot according to the schedule is on %s",
+		"date_inferred":          "Release date was inferred from the schedule and set to the next free slot on %s",
+		"date_confirm_task":      "Confirm the release date %s inferred from the schedule",
+		"audio_ok":               "The audio file meets the technical requirements",
+		"audio_check_failed":     "The audio file couldn't be checked, %s",
+		"audio_check_task":       "Listen to the audio file and check it before the broadcast",
+		"audio_duration":         "The length of the audio file (%s) differs from the length of the slot (%s)",
+		"audio_duration_task":    "Adjust the audio file to the slot length of %s",
+		"audio_loudness":         "The loudness of the audio file is %.1f LUFS instead of %.1f LUFS",
+		"audio_loudness_task":    "Normalize the audio file to %.1f LUFS",
+		"audio_true_peak":        "The true peak of the audio file of %.1f dBTP exceeds %.1f dBTP",
+		"audio_true_peak_task":   "Limit the audio file so the true peak doesn't exceed %.1f dBTP",
+		"audio_sample_rate":      "The audio file has a sample rate of %d Hz, allowed are %s Hz",
+		"audio_channels":         "The audio file has %d channels, allowed are %s",
+		"audio_format_task":      "Export the audio file again in the required format",
+		"audio_leading_silence":  "The audio file starts with %.1f seconds of silence",
+		"audio_trailing_silence": "The audio file ends with %.1f seconds of silence",
+		"audio_silence_task":     "Remove the silence at the start and end of the audio file",
+		"duplicate_audio":        "The audio file is identical to the one of item %s ('%s', uploaded on %s)",
+		"duplicate_metadata":     "Title, show and broadcast date match the item %s ('%s', uploaded on %s)",
+		"duplicate_task":         "Check whether the item is a duplicate of %s and delete one of them if so",
+		"duplicate_others":       "Further possible duplicates: %s",
+		"channel_set":            "Channel was set to radio",
+		"channel_failed":         "Channel couldn't be set to radio",
+		"channel_task":           "Set the channel to radio",
+		"subtitle_moved":         "Moved the content of the field »Subtitle« to »Alternative Title«",
+		"subtitle_failed":        "Producers couldn't be moved to the field »Alternative Title«",
+		"subtitle_task":          "Move the producers to the field »Alternative Title«",
+		"clear_subtitle_task":    "Clear the field »Subtitle«",
+		"description_moved":      "Moved the content of the field »Description« to »Alternative Description«",
+		"description_failed":     "Content of the field »Description« couldn't be moved to »Alternative Description«",
+		"description_task":       "Move the content of »Description« to »Alternative Description«",
+		"clear_description_task": "Clear the field »Description«",
+		"source_empty":           "The field %s is empty, nothing was transferred",
+		"retry_abandoned":        "Item %s couldn't be processed even after several attempts (%s). Please reprocess it with `radio-ingest reprocess --id %[1]s` or `POST /items/%[1]s/reprocess`.",
+	},
+}
+
+// Built-in templates for the report on an upload by locale.
+var reportTemplates = map[string]string{
+	"de": `*Neue Radiodatei hochgeladen*
+
+:pencil2: Der:die Produzent:in hat folgende Metadaten angegeben:
+- Titel: _{{.Notification.Data.General.Title}}_
+- Produzent.in: _{{.Notification.Data.General.SubTitle}}_
+- Sendungsname: _{{.Notification.Data.General.RefNr}}_
+- Beabsichtigte Veröffentlichung am: _{{.Notification.Data.General.Description}}_
+
+{{if .ErrResults -}}
+:alert: Während der Verarbeitung traten folgende(r) Fehler auf:
+{{range .ErrResults -}}
+- {{.}}
+{{end -}}
+{{end -}}
+{{if .OkResults -}}
+:robot: Basierend auf diesen Angaben wurde die Sendung wie folgt aufbereitet:
+{{range .OkResults -}}
+- {{.}}
+{{end -}}
+{{end -}}
+{{if .ManualTasks -}}
+:tick: Folgende manuelle Schritte sind notwendig:
+{{range .ManualTasks -}}
+- {{.}}
+{{end -}}
+{{end -}}
+
+Waveform: {{.Waveform}}
+`,
+	"en": `*New radio file uploaded*
+
+:pencil2: The producer provided the following metadata:
+- Title: _{{.Notification.Data.General.Title}}_
+- Producer: _{{.Notification.Data.General.SubTitle}}_
+- Show: _{{.Notification.Data.General.RefNr}}_
+- Intended release on: _{{.Notification.Data.General.Description}}_
+
+{{if .ErrResults -}}
+:alert: The following error(s) occurred during processing:
+{{range .ErrResults -}}
+- {{.}}
+{{end -}}
+{{end -}}
+{{if .OkResults -}}
+:robot: Based on this information the item was prepared as follows:
+{{range .OkResults -}}
+- {{.}}
+{{end -}}
+{{end -}}
+{{if .ManualTasks -}}
+:tick: The following manual steps are necessary:
+{{range .ManualTasks -}}
+- {{.}}
+{{end -}}
+{{end -}}
+
+Waveform: {{.Waveform}}
+`,
+}
+
+// Built-in templates for the alert on interrupted uploads by locale.
+var staleTemplates = map[string]string{
+	"de": `*Unvollständig verarbeitete Radiodateien*
+
+:alert: Die Verarbeitung folgender Beiträge wurde unterbrochen (z.B. durch einen Neustart des Dienstes):
+{{range . -}}
+- {{.}}
+{{end}}
+:tick: Bitte die Beiträge mit ` + "`radio-ingest reprocess --id <ID>`" + ` bzw. ` + "`POST /items/<ID>/reprocess`" + ` erneut verarbeiten lassen oder die Metadaten manuell ergänzen.
+`,
+	"en": `*Incompletely processed radio files*
+
+:alert: The processing of the following items was interrupted (e.g. by a restart of the service):
+{{range . -}}
+- {{.}}
+{{end}}
+:tick: Please process the items again with ` + "`radio-ingest reprocess --id <ID>`" + ` or ` + "`POST /items/<ID>/reprocess`" + `, or complete their metadata manually.
+`,
+}
+
+// Data available in the report template.
+type ReportData struct {
+	Notification notification.Notification
+	OkResults    []string
+	ErrResults   []string
+	ManualTasks  []string
+	Waveform     string
+}
+
+// Localized texts and templates for the messages of the daemon.
+type Messages struct {
+	Locale string
+	report *template.Template
+	stale  *template.Template
+}
+
+// Returns the [Messages] for the given locale. Templates are loaded from the
+// files given in the config, the built-in templates of the locale are used
+// for all others.
+func NewMessages(locale string, files config.TemplateConfig) (*Messages, error) {
+	if locale == "" {
+		locale = defaultLocale
+	}
+	if _, ok := messageCatalog[locale]; !ok {
+		return nil, fmt.Errorf("unsupported locale %s", locale)
+	}
+	report, err := loadTemplate("report", files.Report, reportTemplates[locale])
+	if err != nil {
+		return nil, err
+	}
+	stale, err := loadTemplate("stale", files.Stale, staleTemplates[locale])
+	if err != nil {
+		return nil, err
+	}
+	return &Messages{
+		Locale: locale,
+		report: report,
+		stale:  stale,
+	}, nil
+}
+
+// Parses the template from the given path. Uses the fallback if no path is
+// given.
+func loadTemplate(name string, path string, fallback string) (*template.Template, error) {
+	src := fallback
+	if path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s template, %s", name, err)
+		}
+		src = string(raw)
+	}
+	rsl, err := template.New(name).Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template, %s", name, err)
+	}
+	return rsl, nil
+}
+
+// Returns the built-in messages of the default locale.
+func DefaultMessages() Messages {
+	rsl, err := NewMessages(defaultLocale, config.TemplateConfig{})
+	if err != nil {
+		panic(err)
+	}
+	return *rsl
+}
+
+// Returns the text for the message ID, formatted with the given arguments.
+// Falls back to the default locale if the text is missing. Unknown IDs are
+// returned as they are, so literal texts can be used in place of an ID.
+func (m Messages) Text(id string, args ...any) string {
+	text, ok := messageCatalog[m.Locale][id]
+	if !ok {
+		text, ok = messageCatalog[defaultLocale][id]
+	}
+	if !ok {
+		text = id
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// Returns the texts for all message IDs.
+func (m Messages) Texts(ids []string) []string {
+	var rsl []string
+	for _, id := range ids {
+		rsl = append(rsl, m.Text(id))
+	}
+	return rsl
+}
+
+// Renders the report on an upload.
+func (m Messages) Report(data ReportData) (string, error) {
+	var rsl bytes.Buffer
+	if err := m.report.Execute(&rsl, data); err != nil {
+		return "", err
+	}
+	return rsl.String(), nil
+}
+
+// Renders the alert on uploads which were interrupted.
+func (m Messages) Stale(ids []string) (string, error) {
+	var rsl bytes.Buffer
+	if err := m.stale.Execute(&rsl, ids); err != nil {
+		return "", err
+	}
+	return rsl.String(), nil
+}
+
+// Renders the report for a notification with example results. Allows to
+// preview a template without processing the notification.
+func (m Messages) PreviewReport(ntf notification.Notification) (string, error) {
+	general := ntf.Data.General
+	return m.Report(ReportData{
+		Notification: ntf,
+		OkResults: []string{
+			m.Text("show_linked", fmt.Sprintf("%s (100%%)", general.RefNr)),
+			m.Text("channel_set"),
+		},
+		ErrResults: []string{
+			m.Text("date_not_found"),
+		},
+		ManualTasks: []string{
+			m.Text("date_not_found_task"),
+		},
+		Waveform: ntf.Data.ImageData.Waveform,
+	})
+}
@@ -0,0 +1,18 @@
+package daemon
+
+import (
+	"github.com/alex-berlin-tv/nexx_omnia_go/omnia"
+	"github.com/alex-berlin-tv/nexx_omnia_go/omnia/enums"
+	"github.com/alex-berlin-tv/nexx_omnia_go/omnia/params"
+)
+
+// The subset of the Omnia API used by the daemon. Implemented by
+// [omnia.Omnia], the tests use an in-memory fake.
+type OmniaClient interface {
+	// Returns an item of the given stream type by its ID.
+	ById(streamType enums.StreamType, id int, parameters params.QueryParameters) (*omnia.Response[any], error)
+	// Returns all items of the given stream type.
+	All(streamType enums.StreamType, parameters params.QueryParameters) (*omnia.Response[omnia.MediaResult], error)
+	// Updates the metadata of an item.
+	Update(streamType enums.StreamType, id int, parameters params.Custom) (*omnia.Response[any], error)
+}
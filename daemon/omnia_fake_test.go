@@ -0,0 +1,198 @@
+package daemon
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/alex-berlin-tv/nexx_omnia_go/omnia"
+	"github.com/alex-berlin-tv/nexx_omnia_go/omnia/enums"
+	"github.com/alex-berlin-tv/nexx_omnia_go/omnia/params"
+)
+
+// A call to the [fakeOmnia].
+type fakeOmniaCall struct {
+	// Name of the called method.
+	Method     string
+	StreamType enums.StreamType
+	ID         int
+	// Fields of an update call.
+	Fields params.Custom
+}
+
+// In-memory implementation of [OmniaClient] for testing the handlers without
+// network access. Holds audio items and shows and records all calls. Updates
+// are applied to the general data of the stored items.
+type fakeOmnia struct {
+	mu *sync.Mutex
+	// Audio items by their ID. Each item is a map of sections (general,
+	// imagedata, ...) as returned by the Media API.
+	Items map[int]map[string]any
+	Shows omnia.MediaResult
+	Calls []fakeOmniaCall
+	// Errors returned by the given method. Allows to simulate failures.
+	Errors map[string]error
+}
+
+// Returns a new empty [fakeOmnia] instance.
+func newFakeOmnia() *fakeOmnia {
+	return &fakeOmnia{
+		mu:     &sync.Mutex{},
+		Items:  make(map[int]map[string]any),
+		Errors: make(map[string]error),
+	}
+}
+
+// Adds an audio item with the given general data.
+func (f *fakeOmnia) AddItem(id int, general map[string]any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	general["ID"] = id
+	f.Items[id] = map[string]any{"general": general}
+}
+
+// Adds a show with the given ID and title.
+func (f *fakeOmnia) AddShow(id int, title string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Shows = append(f.Shows, omnia.MediaResultItem{
+		General: omnia.MediaResultGeneral{Id: id, Title: title},
+	})
+}
+
+// Returns all recorded calls of the given method.
+func (f *fakeOmnia) CallsOf(method string) []fakeOmniaCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var rsl []fakeOmniaCall
+	for _, call := range f.Calls {
+		if call.Method == method {
+			rsl = append(rsl, call)
+		}
+	}
+	return rsl
+}
+
+func (f *fakeOmnia) ById(streamType enums.StreamType, id int, parameters params.QueryParameters) (*omnia.Response[any], error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Calls = append(f.Calls, fakeOmniaCall{Method: "ById", StreamType: streamType, ID: id})
+	if err := f.Errors["ById"]; err != nil {
+		return fakeErrorResponse[any](err)
+	}
+	item, ok := f.Items[id]
+	if !ok {
+		return fakeErrorResponse[any](fmt.Errorf("item %d not found", id))
+	}
+	var rsl any = item
+	return &omnia.Response[any]{
+		Metadata: omnia.ResponseMetadata{Status: 200},
+		Result:   &rsl,
+	}, nil
+}
+
+// Returns the stored shows for the show stream type and the stored audio
+// items ordered by ID otherwise. Respects the start and limit of
+// [params.Basic].
+func (f *fakeOmnia) All(streamType enums.StreamType, parameters params.QueryParameters) (*omnia.Response[omnia.MediaResult], error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Calls = append(f.Calls, fakeOmniaCall{Method: "All", StreamType: streamType})
+	if err := f.Errors["All"]; err != nil {
+		return fakeErrorResponse[omnia.MediaResult](err)
+	}
+	var items omnia.MediaResult
+	if streamType == enums.ShowStreamType {
+		items = f.Shows
+	} else {
+		var ids []int
+		for id := range f.Items {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+		for _, id := range ids {
+			general, _ := f.Items[id]["general"].(map[string]any)
+			title, _ := general["title"].(string)
+			items = append(items, omnia.MediaResultItem{
+				General: omnia.MediaResultGeneral{Id: id, Title: title},
+			})
+		}
+	}
+	start, limit := 0, len(items)
+	if basic, ok := parameters.(params.Basic); ok {
+		start = basic.Start
+		if basic.Limit > 0 {
+			limit = basic.Limit
+		}
+	}
+	rsl := omnia.MediaResult{}
+	if start < len(items) {
+		end := start + limit
+		if end > len(items) {
+			end = len(items)
+		}
+		rsl = append(rsl, items[start:end]...)
+	}
+	return &omnia.Response[omnia.MediaResult]{
+		Metadata: omnia.ResponseMetadata{Status: 200},
+		Result:   &rsl,
+		Paging: &omnia.ResponsePaging{
+			Start:       start,
+			Limit:       limit,
+			ResultCount: len(items),
+		},
+	}, nil
+}
+
+func (f *fakeOmnia) Update(streamType enums.StreamType, id int, parameters params.Custom) (*omnia.Response[any], error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Calls = append(f.Calls, fakeOmniaCall{Method: "Update", StreamType: streamType, ID: id, Fields: parameters})
+	if err := f.Errors["Update"]; err != nil {
+		return fakeErrorResponse[any](err)
+	}
+	item, ok := f.Items[id]
+	if !ok {
+		return fakeErrorResponse[any](fmt.Errorf("item %d not found", id))
+	}
+	general, ok := item["general"].(map[string]any)
+	if !ok {
+		general = make(map[string]any)
+		item["general"] = general
+	}
+	for field, value := range parameters {
+		general[field] = value
+	}
+	return &omnia.Response[any]{
+		Metadata: omnia.ResponseMetadata{Status: 200},
+	}, nil
+}
+
+// Builds a failed response in the same way the Omnia API reports errors.
+func fakeErrorResponse[T any](err error) (*omnia.Response[T], error) {
+	hint := err.Error()
+	return &omnia.Response[T]{
+		Metadata: omnia.ResponseMetadata{Status: 500, ErrorHint: &hint},
+	}, err
+}
+
+func TestFakeOmniaAllPagesByID(t *testing.T) {
+	fake := newFakeOmnia()
+	for _, id := range []int{5, 3, 9, 1, 7} {
+		fake.AddItem(id, map[string]any{"title": fmt.Sprint(id)})
+	}
+	var ids []int
+	for start := 0; start < 5; start += 2 {
+		rsp, err := fake.All(enums.AudioStreamType, params.Basic{Start: start, Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range *rsp.Result {
+			ids = append(ids, item.General.Id)
+		}
+	}
+	if fmt.Sprint(ids) != "[1 3 5 7 9]" {
+		t.Errorf("paged items %v, want them ordered by ID", ids)
+	}
+}
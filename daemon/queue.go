@@ -0,0 +1,174 @@
+package daemon
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.etcd.io/bbolt"
+)
+
+const retryQueueBucket = "RetryQueue"
+
+// Interval in which the retry queue is checked for due entries.
+const retryQueueInterval = 10 * time.Second
+
+// A notification which failed to process and waits for another attempt.
+type queueEntry struct {
+	Body        []byte    `json:"body"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error"`
+}
+
+// Durable queue for notifications which failed to process. The entries are
+// stored in the bbolt DB and thus survive a restart of the daemon. Failed
+// attempts are retried with an exponential backoff until the maximum number
+// of attempts is reached.
+type RetryQueue struct {
+	DB          *bbolt.DB
+	MaxAttempts int
+	BaseDelay   time.Duration
+	// Called with the body and the last error of a notification which
+	// reached the maximum number of attempts. Optional.
+	GiveUp func(body []byte, cause error)
+}
+
+// Returns a new [RetryQueue] instance and ensures the existence of the bucket.
+func NewRetryQueue(db *bbolt.DB, maxAttempts int, baseDelay time.Duration) (*RetryQueue, error) {
+	err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(retryQueueBucket))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &RetryQueue{
+		DB:          db,
+		MaxAttempts: maxAttempts,
+		BaseDelay:   baseDelay,
+	}, nil
+}
+
+// Adds a notification body which failed to process to the queue. The cause
+// of the failure is stored alongside for later inspection.
+func (q RetryQueue) Enqueue(body []byte, cause error) error {
+	entry := queueEntry{
+		Body:        body,
+		Attempts:    1,
+		NextAttempt: time.Now().Add(q.backoff(1)),
+		LastError:   cause.Error(),
+	}
+	return q.DB.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(retryQueueBucket))
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		return q.put(bucket, queueKey(seq), entry)
+	})
+}
+
+// Periodically retries all due entries with the given function until the
+// done channel is closed.
+func (q RetryQueue) Run(fn func([]byte) error, done <-chan struct{}) {
+	ticker := time.NewTicker(retryQueueInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			q.process(fn, false, done)
+		}
+	}
+}
+
+// Retries all entries regardless of their next attempt time. Used on startup
+// to process notifications which arrived during an outage. Stops after the
+// current entry once the done channel is closed, the remaining entries stay
+// in the queue.
+func (q RetryQueue) Drain(fn func([]byte) error, done <-chan struct{}) {
+	q.process(fn, true, done)
+}
+
+func (q RetryQueue) process(fn func([]byte) error, all bool, done <-chan struct{}) {
+	entries := make(map[string]queueEntry)
+	err := q.DB.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(retryQueueBucket))
+		return bucket.ForEach(func(k, v []byte) error {
+			var entry queueEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				logrus.Errorf("invalid retry queue entry %x, %s", k, err)
+				return nil
+			}
+			if all || time.Now().After(entry.NextAttempt) {
+				entries[string(k)] = entry
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		logrus.Error(err)
+		return
+	}
+	for key, entry := range entries {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		entry.Attempts++
+		logFields := logrus.Fields{"attempt": entry.Attempts, "max_attempts": q.MaxAttempts}
+		logrus.WithFields(logFields).Info("retry failed notification")
+		if err := fn(entry.Body); err != nil {
+			entry.LastError = err.Error()
+			entry.NextAttempt = time.Now().Add(q.backoff(entry.Attempts))
+			if entry.Attempts >= q.MaxAttempts {
+				logrus.WithFields(logFields).Errorf("giving up on notification, %s", err)
+				if q.GiveUp != nil {
+					q.GiveUp(entry.Body, err)
+				}
+				err = q.delete([]byte(key))
+			} else {
+				logrus.WithFields(logFields).Warnf("retry failed, next attempt at %s, %s", entry.NextAttempt.Format(time.RFC3339), err)
+				err = q.DB.Update(func(tx *bbolt.Tx) error {
+					return q.put(tx.Bucket([]byte(retryQueueBucket)), []byte(key), entry)
+				})
+			}
+			if err != nil {
+				logrus.Error(err)
+			}
+			continue
+		}
+		if err := q.delete([]byte(key)); err != nil {
+			logrus.Error(err)
+		}
+	}
+}
+
+func (q RetryQueue) put(bucket *bbolt.Bucket, key []byte, entry queueEntry) error {
+	dt, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, dt)
+}
+
+func (q RetryQueue) delete(key []byte) error {
+	return q.DB.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(retryQueueBucket)).Delete(key)
+	})
+}
+
+// Returns the delay after the given number of failed attempts.
+func (q RetryQueue) backoff(attempts int) time.Duration {
+	return q.BaseDelay * time.Duration(1<<(attempts-1))
+}
+
+func queueKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
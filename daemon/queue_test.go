@@ -0,0 +1,92 @@
+package daemon
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRetryQueue(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxAttempts int
+		err         error
+		// Number of entries left in the queue.
+		left   int
+		gaveUp bool
+	}{
+		{name: "success", maxAttempts: 3, err: nil, left: 0},
+		{name: "failure", maxAttempts: 3, err: errors.New("unavailable"), left: 1},
+		{name: "last attempt", maxAttempts: 2, err: errors.New("unavailable"), left: 0, gaveUp: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := OpenDB(filepath.Join(t.TempDir(), "test.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			queue, err := NewRetryQueue(db, tt.maxAttempts, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var gaveUp []byte
+			queue.GiveUp = func(body []byte, cause error) {
+				gaveUp = body
+			}
+			if err := queue.Enqueue([]byte("body"), errors.New("first")); err != nil {
+				t.Fatal(err)
+			}
+			queue.Drain(func(body []byte) error {
+				return tt.err
+			}, nil)
+			left := 0
+			queue.Drain(func(body []byte) error {
+				left++
+				return nil
+			}, nil)
+			if left != tt.left {
+				t.Errorf("%d entries left, want %d", left, tt.left)
+			}
+			if (gaveUp != nil) != tt.gaveUp {
+				t.Errorf("gave up on %q, want given up %t", gaveUp, tt.gaveUp)
+			}
+		})
+	}
+}
+
+func TestRetryQueueDrainStopsWhenDone(t *testing.T) {
+	db, err := OpenDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	queue, err := NewRetryQueue(db, 3, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := queue.Enqueue([]byte("body"), errors.New("first")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	done := make(chan struct{})
+	processed := 0
+	queue.Drain(func(body []byte) error {
+		processed++
+		close(done)
+		return nil
+	}, done)
+	if processed != 1 {
+		t.Errorf("processed %d entries after done, want 1", processed)
+	}
+	left := 0
+	queue.Drain(func(body []byte) error {
+		left++
+		return nil
+	}, nil)
+	if left != 2 {
+		t.Errorf("%d entries left, want 2", left)
+	}
+}
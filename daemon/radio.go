@@ -1,60 +1,18 @@
 package daemon
 
 import (
-	"bytes"
+	"encoding/json"
 	"fmt"
-	"sort"
-	"text/template"
 	"time"
 
 	"github.com/alex-berlin-tv/nexx_omnia_go/notification"
 	"github.com/alex-berlin-tv/nexx_omnia_go/omnia"
-	"github.com/alex-berlin-tv/nexx_omnia_go/omnia/enums"
 	"github.com/alex-berlin-tv/nexx_omnia_go/omnia/params"
-	"github.com/alex-berlin-tv/radio-ingest/stackfield"
-	"github.com/lithammer/fuzzysearch/fuzzy"
-	"github.com/markusmobius/go-dateparser"
+	"github.com/alex-berlin-tv/radio-ingest/notifier"
+	"github.com/sirupsen/logrus"
 	"go.etcd.io/bbolt"
 )
 
-const radioChannelId = "31543"
-
-const newRadioIngestMessage string = `*Neue Radiodatei hochgeladen*
-
-:pencil2: Der:die Produzent:in hat folgende Metadaten angegeben:
-- Titel: _{{.Notification.Data.General.Title}}_
-- Produzent.in: _{{.Notification.Data.General.SubTitle}}_
-- Sendungsname: _{{.Notification.Data.General.RefNr}}_
-- Beabsichtigte Veröffentlichung am: _{{.Notification.Data.General.Description}}_
-
-{{if .ErrResults -}}
-:alert: Während der Verarbeitung traten folgende(r) Fehler auf:
-{{range .ErrResults -}}
-- {{.}}
-{{end -}}
-{{end -}}
-{{if .OkResults -}}
-:robot: Basierend auf diesen Angaben wurde die Sendung wie folgt aufbereitet:
-{{range .OkResults -}}
-- {{.}}
-{{end -}}
-{{end -}}
-{{if .ManualTasks -}}
-:tick: Folgende manuelle Schritte sind notwendig:
-{{range .ManualTasks -}}
-- {{.}}
-{{end -}}
-{{end -}}
-
-Waveform: {{.Waveform}}
-`
-
-/*
-{{ if .Data.errorOccurred -}}
-:warning: Es sind Fehler während der automatischen Aufbereitung aufgetreten:
-{{- end }}
-*/
-
 type taskResults []taskResult
 
 func (r taskResults) okResults() []string {
@@ -92,26 +50,149 @@ func (r taskResults) manualTasks() []string {
 
 type taskResult struct {
 	// States whether an action was an success.
-	Success bool
+	Success bool `json:"success"`
 	// Some tasks can be omitted in the user output.
-	Omit bool
+	Omit bool `json:"omit"`
 	// Message to the user stating the action taken and the result of it.
-	Result string
+	Result string `json:"result"`
 	// Instructs the user of the necessary manual tasks.
-	ManualTasks []string
+	ManualTasks []string `json:"manual_tasks"`
+	// Best matching shows with their score, set by the show matching.
+	Candidates []showCandidate `json:"candidates,omitempty"`
+	// Dates found in the description, set by the date extraction.
+	Dates []dateCandidate `json:"dates,omitempty"`
+	// Measurements of the audio file, set by the audio check.
+	Audio *audioAnalysis `json:"audio,omitempty"`
+	// Earlier uploads of the same episode, set by the duplicate detection.
+	Duplicates []uploadRef `json:"duplicates,omitempty"`
 }
 
 const radioUploadBucket = "RadioUpload"
 
+// Modes of the release date inference.
+const (
+	inferDateOff     = "off"
+	inferDatePropose = "propose"
+	inferDateApply   = "apply"
+)
+
+func init() {
+	RegisterHandler("radio_upload", newRadioUploadHandler)
+}
+
+// Settings of the [RadioUpload] handler.
+type RadioUploadSettings struct {
+	// Rules applied to the fields of the item after show and date were
+	// handled.
+	Rules []FieldRule `json:"rules"`
+	// Matching of the show name given by the uploader.
+	ShowMatching ShowMatchSettings `json:"show_matching"`
+	// Extraction of the broadcast date from the description.
+	Dates DateSettings `json:"dates"`
+	// Path to a JSON or iCal file with the weekly broadcast schedule. The
+	// release date is checked against the slots of the show if given.
+	Schedule string `json:"schedule,omitempty"`
+	// What to do if the description contains no date but the show is part
+	// of the schedule: off, propose the next free slot as manual task or
+	// apply it.
+	InferDate string `json:"infer_date"`
+	// Technical check of the uploaded audio file.
+	Audio AudioCheckSettings `json:"audio"`
+}
+
+// Returns the default settings for the [RadioUpload] handler.
+func DefaultRadioUploadSettings() RadioUploadSettings {
+	return RadioUploadSettings{
+		ShowMatching: DefaultShowMatchSettings(),
+		Dates:        DefaultDateSettings(),
+		InferDate:    inferDatePropose,
+		Audio:        DefaultAudioCheckSettings(),
+		Rules: []FieldRule{
+			{
+				Value:       "31543",
+				Target:      "channel",
+				Omit:        true,
+				Result:      "channel_set",
+				ErrorResult: "channel_failed",
+				ManualTasks: []string{"channel_task"},
+			},
+			{
+				Source:           "subtitle",
+				Target:           "alttitle",
+				ClearSource:      true,
+				Omit:             true,
+				Result:           "subtitle_moved",
+				ErrorResult:      "subtitle_failed",
+				ManualTasks:      []string{"subtitle_task"},
+				ClearManualTasks: []string{"clear_subtitle_task"},
+			},
+			{
+				Source:           "description",
+				Target:           "altdescription",
+				ClearSource:      true,
+				Omit:             true,
+				Result:           "description_moved",
+				ErrorResult:      "description_failed",
+				ManualTasks:      []string{"description_task"},
+				ClearManualTasks: []string{"clear_description_task"},
+			},
+		},
+	}
+}
+
+// Checks the settings for invalid rules.
+func (s RadioUploadSettings) validate() error {
+	if err := s.ShowMatching.validate(); err != nil {
+		return err
+	}
+	if err := s.Dates.validate(); err != nil {
+		return err
+	}
+	if err := s.Audio.validate(); err != nil {
+		return err
+	}
+	switch s.InferDate {
+	case inferDateOff, inferDatePropose, inferDateApply:
+	default:
+		return fmt.Errorf("unknown infer_date mode %s", s.InferDate)
+	}
+	for _, rule := range s.Rules {
+		if err := rule.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Handles new radio uploads.
 type RadioUpload struct {
-	Omnia        omnia.Omnia
-	Stackfield   stackfield.Room
+	Omnia        OmniaClient
+	Router       Router
 	Notification notification.Notification
-	DB           *bbolt.DB
+	// Raw body of the notification, stored in the [ProcessingRecord].
+	Body []byte
+	DB   *bbolt.DB
+	// Bypasses the checks for outdated and already processed items. Used to
+	// reprocess an item manually.
+	Force bool
+	// Bypasses the check for outdated items, as notifications from the retry
+	// queue may be older than a day.
+	Retry bool
+	// Only reports the intended changes and the message instead of applying
+	// and sending them.
+	DryRun   bool
+	Settings RadioUploadSettings
+	// Texts and templates of the messages.
+	Messages Messages
+	// Cached list of shows. The shows are fetched from Omnia on each call
+	// if not set.
+	Shows *ShowCatalog
+	// Broadcast schedule loaded from the file given in the settings. Can be
+	// nil.
+	Schedule *Schedule
 }
 
-func NewRadioUpload(omnia omnia.Omnia, stackfield stackfield.Room, db *bbolt.DB, ntf notification.Notification) (*RadioUpload, error) {
+func NewRadioUpload(omnia OmniaClient, router Router, db *bbolt.DB, ntf notification.Notification, body []byte) (*RadioUpload, error) {
 	err := db.Update(func(tx *bbolt.Tx) error {
 		_, err := tx.CreateBucketIfNotExists([]byte(radioUploadBucket))
 		return err
@@ -121,12 +202,42 @@ func NewRadioUpload(omnia omnia.Omnia, stackfield stackfield.Room, db *bbolt.DB,
 	}
 	return &RadioUpload{
 		Omnia:        omnia,
-		Stackfield:   stackfield,
+		Router:       router,
 		DB:           db,
 		Notification: ntf,
+		Body:         body,
+		Settings:     DefaultRadioUploadSettings(),
+		Messages:     DefaultMessages(),
 	}, nil
 }
 
+func newRadioUploadHandler(env HandlerEnv, in Incoming) (Handler, error) {
+	rsl, err := NewRadioUpload(env.Omnia, env.Router, env.DB, in.Notification, in.Body)
+	if err != nil {
+		return nil, err
+	}
+	rsl.Force = in.Force
+	rsl.Retry = in.Retry
+	rsl.DryRun = env.DryRun
+	rsl.Messages = env.Messages
+	rsl.Shows = env.Shows
+	if len(env.Settings) != 0 {
+		if err := json.Unmarshal(env.Settings, &rsl.Settings); err != nil {
+			return nil, fmt.Errorf("invalid settings, %s", err)
+		}
+	}
+	if err := rsl.Settings.validate(); err != nil {
+		return nil, fmt.Errorf("invalid settings, %s", err)
+	}
+	if rsl.Settings.Schedule != "" {
+		rsl.Schedule, err = env.Schedules.Load(rsl.Settings.Schedule, rsl.Settings.Dates.location())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return *rsl, nil
+}
+
 func (u RadioUpload) Name() string {
 	return "New Radio Upload"
 }
@@ -134,265 +245,430 @@ func (u RadioUpload) Name() string {
 func (u RadioUpload) Matches() bool {
 	if u.Notification.Data.PublishingData.Origin != "uploadlink" ||
 		u.Notification.Trigger.Event != "metadata" ||
-		u.Notification.Item.StreamType != "audio" ||
-		time.Since(time.Time(u.Notification.Data.General.Created)) > time.Hour*24 {
+		u.Notification.Item.StreamType != "audio" {
 		return false
 	}
-	exists := false
-	u.DB.View(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket([]byte(radioUploadBucket))
-		value := bucket.Get([]byte(u.Notification.Item.ID))
-		exists = len(value) > 0
-		return nil
-	})
-	return !exists
+	if u.Force {
+		return true
+	}
+	if !u.Retry && time.Since(time.Time(u.Notification.Data.General.Created)) > time.Hour*24 {
+		return false
+	}
+	rec, err := loadProcessingRecord(u.DB, u.Notification.Item.ID)
+	if err != nil {
+		logrus.Error(err)
+		return false
+	}
+	// Failed items are handled again so retries can complete them.
+	return rec == nil || rec.Status == statusFailed
 }
 
 func (u RadioUpload) OnNotification() error {
-	err := u.DB.Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket([]byte(radioUploadBucket))
-		return bucket.Put([]byte(u.Notification.Item.ID), []byte("processing"))
-	})
+	rec, err := loadProcessingRecord(u.DB, u.Notification.Item.ID)
 	if err != nil {
 		return err
 	}
-	var rsl taskResults
-	rsl = append(rsl, u.handleShow())
-	rsl = append(rsl, u.handleDate())
-	rsl = append(rsl, u.handleChannel())
-	rsl = append(rsl, u.handleSubtitleField())
-	rsl = append(rsl, u.handleDescriptionField())
-	if err := u.sendMessage(rsl); err != nil {
-		return err
+	if rec == nil {
+		tmp := NewProcessingRecord(u.Notification.Item.ID)
+		rec = &tmp
 	}
-	return u.DB.Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket([]byte(radioUploadBucket))
-		return bucket.Put([]byte(u.Notification.Item.ID), []byte("done"))
-	})
-}
-
-func (u RadioUpload) sendMessage(rsl taskResults) error {
-	tpl, err := template.New("message").Parse(newRadioIngestMessage)
-	if err != nil {
+	if !u.Force && rec.Status == statusFailed && rec.Message != "" {
+		// The tasks were applied by the previous run, only the delivery of
+		// the message failed.
+		return u.resendMessage(rec)
+	}
+	rec.Status = statusProcessing
+	rec.Message = ""
+	rec.Delivery = nil
+	rec.Title = u.Notification.Data.General.Title
+	if producer := u.Notification.Data.General.SubTitle; producer != "" {
+		rec.Producer = producer
+	}
+	rec.Notification = withoutSecret(u.Body)
+	rec.Attempts++
+	if err := u.saveRecord(rec); err != nil {
 		return err
 	}
-	dt := struct {
-		Notification notification.Notification
-		OkResults    []string
-		ErrResults   []string
-		ManualTasks  []string
-		Waveform     string
-	}{
+	var tasks []plannedTask
+	showTask, show := u.handleShow()
+	if show != nil {
+		rec.ShowID = show.General.Id
+		rec.Show = show.General.Title
+	}
+	tasks = append(tasks, showTask)
+	dateTask, date := u.handleDate(show)
+	if date != nil {
+		rec.ReleaseDate = &date.Date
+	}
+	tasks = append(tasks, dateTask)
+	if task, ok := u.checkSchedule(show, date); ok {
+		tasks = append(tasks, task)
+	}
+	audioTasks, analysis := u.checkAudio(rec, show, date)
+	tasks = append(tasks, audioTasks...)
+	if task, ok := u.checkDuplicates(rec, analysis); ok {
+		tasks = append(tasks, task)
+	}
+	for _, rule := range u.Settings.Rules {
+		tasks = append(tasks, u.planRule(rule))
+	}
+	rsl := u.applyTasks(tasks)
+	rec.Results = rsl
+	msg, err := u.Messages.Report(ReportData{
 		Notification: u.Notification,
 		OkResults:    rsl.okResults(),
 		ErrResults:   rsl.errResults(),
 		ManualTasks:  rsl.manualTasks(),
 		Waveform:     u.Notification.Data.ImageData.Waveform,
-	}
-	var msg bytes.Buffer
-	if err := tpl.Execute(&msg, dt); err != nil {
+	})
+	if err != nil {
+		rec.Status = statusFailed
+		rec.MessageError = err.Error()
+		if err := u.saveRecord(rec); err != nil {
+			logrus.Error(err)
+		}
 		return err
 	}
-	if err := u.Stackfield.Send(msg.String()); err != nil {
+	rec.Message = msg
+	rec.Delivery = notifier.Delivery{}
+	return u.deliverMessage(rec)
+}
+
+// Sends the message of the previous run to the notifiers which didn't
+// receive it yet.
+func (u RadioUpload) resendMessage(rec *ProcessingRecord) error {
+	logrus.WithField("item", rec.ItemID).Info("tasks were already applied, only sending the message to the remaining notifiers")
+	rec.Attempts++
+	if rec.Delivery == nil {
+		rec.Delivery = notifier.Delivery{}
+	}
+	return u.deliverMessage(rec)
+}
+
+// Sends the message of the record to the notifiers picked by the router and
+// saves the outcome.
+func (u RadioUpload) deliverMessage(rec *ProcessingRecord) error {
+	msgCtx := newMessageContext(rec.ShowID, rec.Show, rec.Producer, rec.Results)
+	if err := u.sendMessage(rec.Message, msgCtx, rec.Delivery); err != nil {
+		rec.Status = statusFailed
+		rec.MessageSent = false
+		rec.MessageError = err.Error()
+		if err := u.saveRecord(rec); err != nil {
+			logrus.Error(err)
+		}
 		return err
 	}
-	return nil
+	rec.Status = statusDone
+	rec.MessageSent = true
+	rec.MessageError = ""
+	return u.saveRecord(rec)
+}
+
+// Saves the processing record. Records aren't touched in dry-run mode.
+func (u RadioUpload) saveRecord(rec *ProcessingRecord) error {
+	if u.DryRun {
+		return nil
+	}
+	return rec.save(u.DB)
 }
 
-func (u RadioUpload) handleShow() taskResult {
-	show, err := u.showByName(u.Notification.Data.General.RefNr)
+// Sends the report to the notifiers picked by the router which didn't
+// receive it according to the delivery.
+func (u RadioUpload) sendMessage(msg string, msgCtx messageContext, delivery notifier.Delivery) error {
+	if u.DryRun {
+		fmt.Printf("[dry-run] message:\n%s\n", msg)
+		return nil
+	}
+	return u.Router.For(msgCtx).Deliver(msg, delivery)
+}
+
+// Links the item to the show given by the uploader and clears the reference
+// number field. The show is only linked if it's the single best match above
+// the threshold, otherwise the candidates are reported as a manual task.
+// Also returns the matched show, nil if none was linked.
+func (u RadioUpload) handleShow() (plannedTask, *omnia.MediaResultItem) {
+	name := u.Notification.Data.General.RefNr
+	candidates, err := u.showCandidates(name)
 	if err != nil {
-		return taskResult{
-			Success: false,
-			Omit:    false,
-			Result:  fmt.Sprintf("Für den angegebenen Sendungsnamen '%s' konnte keine Sendung gefunden werden", u.Notification.Data.General.RefNr),
-			ManualTasks: []string{
-				fmt.Sprintf("Passende Sendung für '%s' finden und entsprechend setzen", u.Notification.Data.General.RefNr),
-				"Inhalt des Felds Referenznummer löschen",
-			},
+		logrus.Error(err)
+	}
+	matching := u.Settings.ShowMatching
+	// The tie check uses all candidates, only the reported ones are limited.
+	reported := matching.reported(candidates)
+	if len(candidates) == 0 || candidates[0].Score < matching.Threshold {
+		manualTasks := []string{u.Messages.Text("show_not_found_task", name)}
+		// Candidates far below the threshold are only noise to the editors.
+		if similar := candidatesAbove(reported, matching.Threshold/2); len(similar) != 0 {
+			manualTasks = append(manualTasks, u.Messages.Text("show_candidates", formatCandidates(similar)))
 		}
+		return resultOnlyTask(taskResult{
+			Success:     false,
+			Omit:        false,
+			Result:      u.Messages.Text("show_not_found", name),
+			ManualTasks: append(manualTasks, u.Messages.Text("clear_refnr_task")),
+			Candidates:  reported,
+		}), nil
 	}
-	rsl, err := u.Omnia.Update(enums.AudioStreamType, u.Notification.Data.General.ID, params.Custom{
-		"show": fmt.Sprint(show.General.Id),
-	})
-	if err != nil && *rsl.Metadata.ErrorHint != "novalidcontext" {
-		return taskResult{
+	if len(candidates) > 1 && candidates[0].Score-candidates[1].Score <= matching.TieMargin {
+		if tied := candidatesAbove(candidates, candidates[0].Score-matching.TieMargin); len(tied) > len(reported) {
+			reported = tied
+		}
+		return resultOnlyTask(taskResult{
 			Success: false,
 			Omit:    false,
-			Result:  fmt.Sprintf("Beitrag konnte nicht mit Sendung '%s' verknüpft werden, %s", show.General.Title, err),
+			Result:  u.Messages.Text("show_ambiguous", name, formatCandidates(reported)),
 			ManualTasks: []string{
-				fmt.Sprintf("Mit Sendung '%s' verbinden", show.General.Title),
-				"Inhalt des Felds Referenznummer löschen",
+				u.Messages.Text("show_ambiguous_task", name),
+				u.Messages.Text("clear_refnr_task"),
 			},
+			Candidates: reported,
+		}), nil
+	}
+	best := candidates[0]
+	result := u.Messages.Text("show_linked", best.String())
+	if best.Alias != "" {
+		result = u.Messages.Text("show_linked_alias", best.Title, best.Alias)
+	} else if len(reported) > 1 {
+		result = fmt.Sprintf("%s, %s", result, u.Messages.Text("show_alternatives", formatCandidates(reported[1:])))
+	}
+	return plannedTask{
+		Fields: params.Custom{
+			"show":  fmt.Sprint(best.ID),
+			"refnr": "",
+		},
+		Result: taskResult{
+			Success:     true,
+			Result:      result,
+			ManualTasks: []string{},
+			Candidates:  reported,
+		},
+		Failure: func(err error) taskResult {
+			return taskResult{
+				Success: false,
+				Omit:    false,
+				Result:  u.Messages.Text("show_link_failed", best.Title, err),
+				ManualTasks: []string{
+					u.Messages.Text("show_link_task", best.Title),
+					u.Messages.Text("clear_refnr_task"),
+				},
+				Candidates: reported,
+			}
+		},
+	}, &best.show
+}
+
+// Returns the shows best matching the given name. If an alias is registered
+// for the name, its show is returned as the only candidate. The show list
+// only provides the title of the aliased show, so the alias also works while
+// Omnia doesn't return the shows.
+func (u RadioUpload) showCandidates(name string) ([]showCandidate, error) {
+	alias, err := LookupAlias(u.DB, name)
+	if err != nil {
+		logrus.Error(err)
+	}
+	shows, err := u.showList()
+	if alias != nil && (err != nil || len(shows) == 0) {
+		if err != nil {
+			logrus.Warnf("failed to load the shows, linking alias '%s' to show %d without checking it, %s", alias.Alias, alias.ShowID, err)
 		}
+		return []showCandidate{aliasCandidate(*alias, omnia.MediaResultItem{
+			General: omnia.MediaResultGeneral{Id: alias.ShowID, Title: fmt.Sprint(alias.ShowID)},
+		})}, nil
 	}
-	_, err = u.Omnia.Update(enums.AudioStreamType, u.Notification.Data.General.ID, params.Custom{
-		"refnr": "",
-	})
 	if err != nil {
-		return taskResult{
-			Success:     false,
-			Omit:        false,
-			Result:      "Referenznummer konnte nicht zurückgesetzt werden",
-			ManualTasks: []string{"Inhalt des Felds Referenznummer löschen"},
+		return nil, err
+	}
+	if alias != nil {
+		for _, show := range shows {
+			if show.General.Id == alias.ShowID {
+				return []showCandidate{aliasCandidate(*alias, show)}, nil
+			}
 		}
+		logrus.Warnf("alias '%s' refers to unknown show %d, falling back to fuzzy matching", alias.Alias, alias.ShowID)
 	}
-	return taskResult{
-		Success:     true,
-		Result:      fmt.Sprintf("Wurde der Sendung '%s' zugeordnet", show.General.Title),
-		ManualTasks: []string{},
+	return rankShows(name, shows, u.Settings.ShowMatching), nil
+}
+
+// Returns the candidate for a show found by an alias.
+func aliasCandidate(alias ShowAlias, show omnia.MediaResultItem) showCandidate {
+	return showCandidate{
+		ID:    show.General.Id,
+		Title: show.General.Title,
+		Score: 1,
+		Alias: alias.Alias,
+		show:  show,
 	}
 }
 
-func (u RadioUpload) showByName(name string) (*omnia.MediaResultItem, error) {
-	rsp, err := u.Omnia.All(enums.ShowStreamType, params.Basic{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to get list of shows, %s", err)
-	}
-	rsl := *rsp.Result
-	var shows = make(map[string]omnia.MediaResultItem)
-	var showNames = []string{}
-	for _, show := range rsl {
-		shows[show.General.Title] = show
-		showNames = append(showNames, show.General.Title)
-	}
-	matches := fuzzy.RankFindNormalizedFold(name, showNames)
-	sort.Sort(matches)
-	if len(matches) != 0 {
-		tmp := shows[matches[0].Source]
-		return &tmp, nil
-	}
-	return nil, fmt.Errorf("not found")
+// Returns all shows, using the catalog if available.
+func (u RadioUpload) showList() ([]omnia.MediaResultItem, error) {
+	if u.Shows != nil {
+		return u.Shows.Shows()
+	}
+	return fetchAllShows(u.Omnia)
 }
 
-func (u RadioUpload) handleDate() taskResult {
-	cfg := dateparser.Configuration{
-		DateOrder:   dateparser.DMY,
-		Languages:   []string{"de"},
-		CurrentTime: time.Now(),
-	}
-	_, rsl, err := dateparser.Search(&cfg, u.Notification.Data.General.Description)
-	if err != nil || len(rsl) == 0 {
-		return taskResult{
-			Success: false,
-			Omit:    false,
-			Result:  "Das Sendedatum konnte nicht aus dem Beschreibungsfeld entnommen werden",
-			ManualTasks: []string{
-				"Das Sendedatum setzen",
-			},
+// Sets the release date to the broadcast date given in the description field
+// and clears the description. Dates outside the allowed window aren't applied
+// but reported as manual task. Further dates in the description (e.g. of a
+// repeat) are listed in the message. If there is no date, the next free slot
+// of the show is inferred from the schedule. Also returns the applied date,
+// nil if none was applied.
+func (u RadioUpload) handleDate(show *omnia.MediaResultItem) (plannedTask, *dateCandidate) {
+	settings := u.Settings.Dates
+	now := time.Now().In(settings.location())
+	dates := extractDates(u.Notification.Data.General.Description, now)
+	if len(dates) == 0 {
+		if task, date, ok := u.inferDate(show, now); ok {
+			return task, date
 		}
-	}
-	date := rsl[0].Date.Time
-	_, err = u.Omnia.Update(enums.AudioStreamType, u.Notification.Data.General.ID, params.Custom{
-		"releasedate": fmt.Sprint(date.Unix()),
-	})
-	if err != nil {
-		return taskResult{
+		return resultOnlyTask(taskResult{
 			Success: false,
 			Omit:    false,
-			Result:  fmt.Sprintf("Veröffentlichungsdatum konnte nicht gesetzt werden, %s", err),
+			Result:  u.Messages.Text("date_not_found"),
 			ManualTasks: []string{
-				fmt.Sprintf("Veröffentlichungsdatum auf %s setzen", date),
+				u.Messages.Text("date_not_found_task"),
 			},
-		}
+		}), nil
 	}
-	_, err = u.Omnia.Update(enums.AudioStreamType, u.Notification.Data.General.ID, params.Custom{
-		"description": "",
-	})
-	if err != nil {
-		return taskResult{
+	date := dates[0]
+	var otherDates []string
+	if len(dates) > 1 {
+		otherDates = []string{u.Messages.Text("date_candidates", formatDates(dates[1:]))}
+	}
+	from, to := settings.window(now)
+	if !date.within(from, to) {
+		return resultOnlyTask(taskResult{
 			Success: false,
 			Omit:    false,
-			Result:  "Beschreibung konnte nicht gelöscht werden",
-		}
-	}
-	return taskResult{
-		Success: true,
-		Omit:    false,
-		Result:  fmt.Sprintf("Veröffentlichungsdatum wurde auf %s gesetzt", date),
+			Result:  u.Messages.Text("date_out_of_window", date, formatWindow(from, to)),
+			ManualTasks: append([]string{
+				u.Messages.Text("date_check_task", date),
+			}, otherDates...),
+			Dates: dates,
+		}), nil
 	}
+	return plannedTask{
+		Fields: params.Custom{
+			"releasedate": fmt.Sprint(date.Date.Unix()),
+			"description": "",
+		},
+		Result: taskResult{
+			Success:     true,
+			Omit:        false,
+			Result:      u.Messages.Text("date_set", date),
+			ManualTasks: otherDates,
+			Dates:       dates,
+		},
+		Failure: func(err error) taskResult {
+			return taskResult{
+				Success: false,
+				Omit:    false,
+				Result:  u.Messages.Text("date_failed", err),
+				ManualTasks: append([]string{
+					u.Messages.Text("date_task", date),
+				}, otherDates...),
+				Dates: dates,
+			}
+		},
+	}, &date
 }
 
-func (u RadioUpload) handleChannel() taskResult {
-	_, err := u.Omnia.Update(enums.AudioStreamType, u.Notification.Data.General.ID, params.Custom{
-		"channel": radioChannelId,
-	})
-	if err != nil {
-		return taskResult{
-			Success:     false,
-			Omit:        false,
-			Result:      "Channel konnte nicht auf Radio gesetzt werden",
-			ManualTasks: []string{"Channel auf Radio setzten"},
-		}
+// Infers the release date from the next free slot of the show after the
+// upload. A slot is free if no other item of the show has a release date on
+// the day of the slot. Depending on the settings the date is only proposed or
+// applied. Applied dates are reserved in the record of the item right away.
+// Returns false if no date can be inferred.
+func (u RadioUpload) inferDate(show *omnia.MediaResultItem, now time.Time) (plannedTask, *dateCandidate, bool) {
+	if u.Settings.InferDate == inferDateOff || show == nil {
+		return plannedTask{}, nil, false
 	}
-	return taskResult{
-		Success: true,
-		Omit:    true,
-		Result:  "Channel wurde auf Radio gesetzt",
+	scheduled := u.Schedule.For(show.General.Id, show.General.Title)
+	if scheduled == nil || len(scheduled.Slots) == 0 {
+		return plannedTask{}, nil, false
 	}
-}
-
-func (u RadioUpload) handleSubtitleField() taskResult {
-	_, err := u.Omnia.Update(enums.AudioStreamType, u.Notification.Data.General.ID, params.Custom{
-		"alttitle": u.Notification.Data.General.SubTitle,
-	})
-	if err != nil {
-		return taskResult{
-			Success: false,
-			Result:  "Produzent:innen konnten nicht in das Feld »Alternativer Titel« übertragen werden",
-			ManualTasks: []string{
-				"Produzent:innen in das Feld »Alternativer Titel« übertragen",
-				"Inhalt des Felds »Untertitel« löschen",
-			},
-		}
+	after := time.Time(u.Notification.Data.General.Created).In(now.Location())
+	if after.Before(now) {
+		after = now
 	}
-	_, err = u.Omnia.Update(enums.AudioStreamType, u.Notification.Data.General.ID, params.Custom{
-		"subtitle": "",
+	_, to := u.Settings.Dates.window(now)
+	reserve := u.Settings.InferDate == inferDateApply && !u.DryRun
+	slot, ok, err := reserveReleaseDate(u.DB, show.General.Id, u.Notification.Item.ID, reserve, func(taken []time.Time) (time.Time, bool) {
+		return scheduled.nextFree(after, to, taken)
 	})
 	if err != nil {
-		return taskResult{
-			Success: false,
-			Result:  "Inhalt des Felds »Untertitel« konnte nicht gelöscht werden",
-			ManualTasks: []string{
-				"Inhalt des Felds »Untertitel« löschen",
-			},
-		}
+		logrus.Error(err)
+		return plannedTask{}, nil, false
 	}
-	return taskResult{
-		Success: true,
-		Omit:    true,
-		Result:  "Inhalt aus dem Feld »Untertitel« nach »Alternativer Titel« übertragen",
+	if !ok {
+		return plannedTask{}, nil, false
 	}
-}
-
-func (u RadioUpload) handleDescriptionField() taskResult {
-	_, err := u.Omnia.Update(enums.AudioStreamType, u.Notification.Data.General.ID, params.Custom{
-		"altdescription": u.Notification.Data.General.Description,
-	})
-	if err != nil {
-		return taskResult{
+	date := dateCandidate{Date: slot, HasTime: true, Inferred: true}
+	if u.Settings.InferDate == inferDatePropose {
+		return resultOnlyTask(taskResult{
 			Success: false,
-			Result:  "Angaben aus dem Feld »Beschreibung« konnten nicht in das Feld »Alternative Beschreibung« übertragen werden",
+			Omit:    false,
+			Result:  u.Messages.Text("date_not_found"),
 			ManualTasks: []string{
-				"Inhalt von »Beschreibung« nach »Alternative Beschreibung« übertragen",
+				u.Messages.Text("date_proposed_task", date),
 			},
-		}
+			Dates: []dateCandidate{date},
+		}), nil, true
 	}
-	_, err = u.Omnia.Update(enums.AudioStreamType, u.Notification.Data.General.ID, params.Custom{
-		"description": "",
-	})
-	if err != nil {
-		return taskResult{
-			Success: false,
-			Result:  "Inhalt des Felds »Beschreibung« konnte nicht gelöscht werden",
+	return plannedTask{
+		Fields: params.Custom{
+			"releasedate": fmt.Sprint(date.Date.Unix()),
+		},
+		Result: taskResult{
+			Success: true,
+			Omit:    false,
+			Result:  u.Messages.Text("date_inferred", date),
 			ManualTasks: []string{
-				"Inhalt des Felds »Beschreibung« löschen",
+				u.Messages.Text("date_confirm_task", date),
 			},
-		}
+			Dates: []dateCandidate{date},
+		},
+		Failure: func(err error) taskResult {
+			return taskResult{
+				Success: false,
+				Omit:    false,
+				Result:  u.Messages.Text("date_failed", err),
+				ManualTasks: []string{
+					u.Messages.Text("date_task", date),
+				},
+				Dates: []dateCandidate{date},
+			}
+		},
+	}, &date, true
+}
+
+// Checks whether the release date falls on a slot of the show in the
+// schedule and suggests the nearest slot otherwise. Returns false if there
+// is nothing to check.
+func (u RadioUpload) checkSchedule(show *omnia.MediaResultItem, date *dateCandidate) (plannedTask, bool) {
+	if show == nil || date == nil || date.Inferred {
+		return plannedTask{}, false
 	}
-	return taskResult{
-		Success: true,
-		Omit:    true,
-		Result:  "Inhalt aus dem Feld »Beschreibung« nach »Alternative Beschreibung« übertragen",
+	scheduled := u.Schedule.For(show.General.Id, show.General.Title)
+	if scheduled == nil || len(scheduled.Slots) == 0 {
+		return plannedTask{}, false
 	}
+	if scheduled.fits(*date) {
+		return resultOnlyTask(taskResult{
+			Success: true,
+			Omit:    true,
+			Result:  u.Messages.Text("date_in_schedule", *date),
+		}), true
+	}
+	nearest, _ := scheduled.nearest(date.Date)
+	slot := dateCandidate{Date: nearest, HasTime: true}
+	return resultOnlyTask(taskResult{
+		Success: false,
+		Omit:    false,
+		Result:  u.Messages.Text("date_not_in_schedule", *date, show.General.Title),
+		ManualTasks: []string{
+			u.Messages.Text("date_slot_task", slot),
+		},
+		Dates: []dateCandidate{slot},
+	}), true
 }
@@ -0,0 +1,450 @@
+package daemon
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alex-berlin-tv/nexx_omnia_go/notification"
+	"github.com/alex-berlin-tv/nexx_omnia_go/omnia"
+)
+
+const testItemID = 4711
+
+// Returns a handler for an upload with the given general data, backed by the
+// fake and a temporary DB.
+func newTestUpload(t *testing.T, fake *fakeOmnia, general notification.GeneralData) RadioUpload {
+	t.Helper()
+	db, err := OpenDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	general.ID = testItemID
+	if time.Time(general.Created).IsZero() {
+		general.Created = notification.UnixTS(time.Now())
+	}
+	var ntf notification.Notification
+	ntf.Item.ID = "4711"
+	ntf.Data.General = general
+	fake.AddItem(testItemID, map[string]any{"title": general.Title})
+	rsl, err := NewRadioUpload(fake, Router{}, db, ntf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *rsl
+}
+
+// Returns a fake with the shows used by the tests.
+func newTestShows() *fakeOmnia {
+	rsl := newFakeOmnia()
+	rsl.AddShow(1, "Kiezradio")
+	rsl.AddShow(2, "Kultur am Abend")
+	rsl.AddShow(3, "Kiezgeflüster")
+	rsl.AddShow(4, "Jazz Lounge")
+	// Shows are sometimes created twice with slightly different titles.
+	rsl.AddShow(5, "Jazz-Lounge")
+	return rsl
+}
+
+func TestHandleShow(t *testing.T) {
+	tests := []struct {
+		name    string
+		refNr   string
+		alias   string
+		success bool
+		showID  int
+		// Minimum number of reported candidates.
+		candidates int
+	}{
+		{name: "exact", refNr: "Kiezradio", success: true, showID: 1},
+		{name: "case and punctuation", refNr: "kiezradio!", success: true, showID: 1},
+		{name: "typo", refNr: "Kiezradoi", success: true, showID: 1},
+		{name: "unknown", refNr: "Morgenmagazin", success: false},
+		{name: "empty", refNr: "", success: false},
+		{name: "subset isn't a match", refNr: "Abend", success: false},
+		{name: "alias", refNr: "KR", alias: "KR", success: true, showID: 1},
+		{name: "tie", refNr: "Jazz Lounge", success: false, candidates: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newTestShows()
+			u := newTestUpload(t, fake, notification.GeneralData{RefNr: tt.refNr})
+			if tt.alias != "" {
+				catalog, err := NewShowCatalog(fake, u.DB, time.Hour)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := AddAlias(u.DB, catalog, tt.alias, tt.showID); err != nil {
+					t.Fatal(err)
+				}
+			}
+			task, show := u.handleShow()
+			if task.Result.Success != tt.success {
+				t.Fatalf("success is %t, want %t: %s", task.Result.Success, tt.success, task.Result.Result)
+			}
+			if !tt.success {
+				if show != nil {
+					t.Errorf("linked show %d, want none", show.General.Id)
+				}
+				if len(task.Fields) != 0 {
+					t.Errorf("changes %v, want none", task.Fields)
+				}
+				if len(task.Result.ManualTasks) == 0 {
+					t.Error("no manual tasks")
+				}
+				if len(task.Result.Candidates) < tt.candidates {
+					t.Errorf("%d candidates, want at least %d", len(task.Result.Candidates), tt.candidates)
+				}
+				return
+			}
+			if show == nil || show.General.Id != tt.showID {
+				t.Fatalf("linked show %v, want %d", show, tt.showID)
+			}
+			if task.Fields["show"] != "1" || task.Fields["refnr"] != "" {
+				t.Errorf("changes %v, want show 1 and empty refnr", task.Fields)
+			}
+		})
+	}
+}
+
+func TestHandleShowUnknownAlias(t *testing.T) {
+	fake := newTestShows()
+	u := newTestUpload(t, fake, notification.GeneralData{RefNr: "KR"})
+	catalog, err := NewShowCatalog(fake, u.DB, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := AddAlias(u.DB, catalog, "KR", 99); err == nil {
+		t.Error("alias for unknown show was added")
+	}
+}
+
+func TestHandleShowAliasWithoutShowList(t *testing.T) {
+	tests := []struct {
+		name    string
+		refNr   string
+		success bool
+	}{
+		{name: "alias", refNr: "KR", success: true},
+		{name: "no alias", refNr: "Kiezradio", success: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newTestShows()
+			u := newTestUpload(t, fake, notification.GeneralData{RefNr: tt.refNr})
+			catalog, err := NewShowCatalog(fake, u.DB, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := AddAlias(u.DB, catalog, "KR", 1); err != nil {
+				t.Fatal(err)
+			}
+			fake.Errors["All"] = fmt.Errorf("unavailable")
+			task, show := u.handleShow()
+			if task.Result.Success != tt.success {
+				t.Fatalf("success is %t, want %t: %s", task.Result.Success, tt.success, task.Result.Result)
+			}
+			if !tt.success {
+				return
+			}
+			if show == nil || show.General.Id != 1 {
+				t.Fatalf("linked show %v, want 1", show)
+			}
+			if task.Fields["show"] != "1" {
+				t.Errorf("changes %v, want show 1", task.Fields)
+			}
+		})
+	}
+}
+
+func TestHandleDate(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := time.Now().In(loc).AddDate(0, 0, 10)
+	nextDate := next.Format("02.01.2006")
+	tests := []struct {
+		name        string
+		description string
+		allowPast   bool
+		success     bool
+		date        time.Time
+		// Number of manual tasks.
+		manualTasks int
+	}{
+		{
+			name:        "date",
+			description: nextDate,
+			success:     true,
+			date:        time.Date(next.Year(), next.Month(), next.Day(), 0, 0, 0, 0, loc),
+		},
+		{
+			name:        "date and time",
+			description: "Sendung am " + nextDate + " um 18:30 Uhr",
+			success:     true,
+			date:        time.Date(next.Year(), next.Month(), next.Day(), 18, 30, 0, 0, loc),
+		},
+		{
+			name:        "repeat",
+			description: nextDate + ", Wiederholung am " + next.AddDate(0, 0, 7).Format("02.01.2006"),
+			success:     true,
+			date:        time.Date(next.Year(), next.Month(), next.Day(), 0, 0, 0, 0, loc),
+			manualTasks: 1,
+		},
+		{
+			name:        "no date",
+			description: "Eine Sendung über Berlin",
+			success:     false,
+			manualTasks: 1,
+		},
+		{
+			name:        "past",
+			description: "01.01.2020",
+			success:     false,
+			manualTasks: 1,
+		},
+		{
+			name:        "past allowed",
+			description: "01.01.2020",
+			allowPast:   true,
+			success:     true,
+			date:        time.Date(2020, 1, 1, 0, 0, 0, 0, loc),
+		},
+		{
+			name:        "too far ahead",
+			description: time.Now().In(loc).AddDate(1, 0, 0).Format("02.01.2006"),
+			success:     false,
+			manualTasks: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := newTestUpload(t, newFakeOmnia(), notification.GeneralData{Description: tt.description})
+			u.Settings.Dates.AllowPast = tt.allowPast
+			task, date := u.handleDate(nil)
+			if task.Result.Success != tt.success {
+				t.Fatalf("success is %t, want %t: %s", task.Result.Success, tt.success, task.Result.Result)
+			}
+			if len(task.Result.ManualTasks) != tt.manualTasks {
+				t.Errorf("manual tasks %v, want %d", task.Result.ManualTasks, tt.manualTasks)
+			}
+			if !tt.success {
+				if date != nil || len(task.Fields) != 0 {
+					t.Errorf("applied date %v with changes %v, want none", date, task.Fields)
+				}
+				return
+			}
+			if date == nil || !date.Date.Equal(tt.date) {
+				t.Fatalf("date %v, want %s", date, tt.date)
+			}
+			if task.Fields["releasedate"] != formatUnix(tt.date) || task.Fields["description"] != "" {
+				t.Errorf("changes %v, want release date %s and empty description", task.Fields, formatUnix(tt.date))
+			}
+		})
+	}
+}
+
+func TestHandleDateInferred(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	show := &omnia.MediaResultItem{General: omnia.MediaResultGeneral{Id: 1, Title: "Kiezradio"}}
+	schedule := &Schedule{Shows: []ScheduledShow{{ShowID: 1, Slots: []Slot{{Weekday: "tuesday", Time: "18:00", Duration: 60}}}}}
+	if err := schedule.Shows[0].Slots[0].parse(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		mode    string
+		success bool
+		applied bool
+	}{
+		{name: "off", mode: inferDateOff, success: false, applied: false},
+		{name: "propose", mode: inferDatePropose, success: false, applied: false},
+		{name: "apply", mode: inferDateApply, success: true, applied: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := newTestUpload(t, newFakeOmnia(), notification.GeneralData{})
+			u.Schedule = schedule
+			u.Settings.InferDate = tt.mode
+			task, date := u.handleDate(show)
+			if task.Result.Success != tt.success {
+				t.Fatalf("success is %t, want %t: %s", task.Result.Success, tt.success, task.Result.Result)
+			}
+			if (date != nil) != tt.applied {
+				t.Fatalf("applied date %v, want applied %t", date, tt.applied)
+			}
+			if tt.mode == inferDateOff {
+				return
+			}
+			if len(task.Result.Dates) != 1 {
+				t.Fatalf("dates %v, want the inferred slot", task.Result.Dates)
+			}
+			slot := task.Result.Dates[0].Date.In(loc)
+			if slot.Weekday() != time.Tuesday || slot.Hour() != 18 || !task.Result.Dates[0].Inferred {
+				t.Errorf("inferred %v, want an inferred tuesday 18:00", task.Result.Dates[0])
+			}
+		})
+	}
+}
+
+func TestInferDateSkipsTakenSlots(t *testing.T) {
+	show := &omnia.MediaResultItem{General: omnia.MediaResultGeneral{Id: 1, Title: "Kiezradio"}}
+	schedule := &Schedule{Shows: []ScheduledShow{{ShowID: 1, Slots: []Slot{{Weekday: "tuesday", Time: "18:00"}}}}}
+	if err := schedule.Shows[0].Slots[0].parse(); err != nil {
+		t.Fatal(err)
+	}
+	u := newTestUpload(t, newFakeOmnia(), notification.GeneralData{})
+	u.Schedule = schedule
+	u.Settings.InferDate = inferDateApply
+	now := time.Now().In(u.Settings.Dates.location())
+	first := schedule.Shows[0].Slots[0].next(now)
+	// Another item of the show is released on the day of the first slot
+	// without time.
+	taken := startOfDay(first)
+	other := NewProcessingRecord("1")
+	other.ShowID = 1
+	other.ReleaseDate = &taken
+	if err := other.save(u.DB); err != nil {
+		t.Fatal(err)
+	}
+	_, date := u.handleDate(show)
+	if date == nil || !date.Date.Equal(first.AddDate(0, 0, 7)) {
+		t.Fatalf("inferred %v, want %s", date, first.AddDate(0, 0, 7))
+	}
+	rec, err := loadProcessingRecord(u.DB, "4711")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec == nil || rec.ReleaseDate == nil || !rec.ReleaseDate.Equal(date.Date) {
+		t.Errorf("record %v doesn't reserve %s", rec, date.Date)
+	}
+}
+
+func TestCheckSchedule(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	show := &omnia.MediaResultItem{General: omnia.MediaResultGeneral{Id: 1, Title: "Kiezradio"}}
+	schedule := &Schedule{Shows: []ScheduledShow{{Show: "Kiezradio", Slots: []Slot{{Weekday: "di", Time: "23:00", Duration: 120}}}}}
+	if err := schedule.Shows[0].Slots[0].parse(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		date    dateCandidate
+		success bool
+	}{
+		{name: "slot start", date: dateCandidate{Date: time.Date(2026, 10, 20, 23, 0, 0, 0, loc), HasTime: true}, success: true},
+		{name: "after midnight within slot", date: dateCandidate{Date: time.Date(2026, 10, 21, 0, 30, 0, 0, loc), HasTime: true}, success: true},
+		{name: "after slot", date: dateCandidate{Date: time.Date(2026, 10, 21, 1, 0, 0, 0, loc), HasTime: true}, success: false},
+		{name: "weekday without time", date: dateCandidate{Date: time.Date(2026, 10, 20, 0, 0, 0, 0, loc)}, success: true},
+		{name: "wrong weekday", date: dateCandidate{Date: time.Date(2026, 10, 19, 0, 0, 0, 0, loc)}, success: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := newTestUpload(t, newFakeOmnia(), notification.GeneralData{})
+			u.Schedule = schedule
+			task, ok := u.checkSchedule(show, &tt.date)
+			if !ok {
+				t.Fatal("schedule wasn't checked")
+			}
+			if task.Result.Success != tt.success {
+				t.Errorf("success is %t, want %t: %s", task.Result.Success, tt.success, task.Result.Result)
+			}
+		})
+	}
+}
+
+func TestOnNotificationAppliesTasksInOneUpdate(t *testing.T) {
+	fake := newTestShows()
+	u := newTestUpload(t, fake, notification.GeneralData{
+		Title:       "Folge 12",
+		SubTitle:    "Neues aus dem Kiez",
+		Description: time.Now().AddDate(0, 0, 10).Format("02.01.2006"),
+		RefNr:       "Kiezradio",
+	})
+	if err := u.OnNotification(); err != nil {
+		t.Fatal(err)
+	}
+	updates := fake.CallsOf("Update")
+	if len(updates) != 1 {
+		t.Fatalf("%d updates, want 1", len(updates))
+	}
+	fields := updates[0].Fields
+	for field, want := range map[string]string{
+		"show":        "1",
+		"refnr":       "",
+		"alttitle":    "Neues aus dem Kiez",
+		"subtitle":    "",
+		"description": "",
+		"channel":     "31543",
+	} {
+		if got, ok := fields[field]; !ok || got != want {
+			t.Errorf("field %s is '%v', want '%s'", field, got, want)
+		}
+	}
+	rec, err := loadProcessingRecord(u.DB, "4711")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Status != statusDone || rec.ShowID != 1 || rec.ReleaseDate == nil {
+		t.Errorf("record %+v, want done with show and release date", rec)
+	}
+	if !strings.Contains(rec.Message, "Kiezradio") {
+		t.Errorf("message doesn't mention the show:\n%s", rec.Message)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		age     time.Duration
+		status  string
+		force   bool
+		retry   bool
+		matches bool
+	}{
+		{name: "new", age: time.Hour, matches: true},
+		{name: "outdated", age: 48 * time.Hour, matches: false},
+		{name: "outdated retry", age: 48 * time.Hour, retry: true, matches: true},
+		{name: "outdated reprocess", age: 48 * time.Hour, force: true, matches: true},
+		{name: "done", age: time.Hour, status: statusDone, matches: false},
+		{name: "done retry", age: time.Hour, status: statusDone, retry: true, matches: false},
+		{name: "failed retry", age: 48 * time.Hour, status: statusFailed, retry: true, matches: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := newTestUpload(t, newFakeOmnia(), notification.GeneralData{
+				Created: notification.UnixTS(time.Now().Add(-tt.age)),
+			})
+			u.Notification.Data.PublishingData.Origin = "uploadlink"
+			u.Notification.Trigger.Event = "metadata"
+			u.Notification.Item.StreamType = "audio"
+			u.Force = tt.force
+			u.Retry = tt.retry
+			if tt.status != "" {
+				rec := NewProcessingRecord(u.Notification.Item.ID)
+				rec.Status = tt.status
+				if err := rec.save(u.DB); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := u.Matches(); got != tt.matches {
+				t.Errorf("matches is %t, want %t", got, tt.matches)
+			}
+		})
+	}
+}
+
+// Returns the release date as stored in Omnia.
+func formatUnix(t time.Time) string {
+	return fmt.Sprint(t.Unix())
+}
@@ -0,0 +1,94 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/alex-berlin-tv/nexx_omnia_go/notification"
+	"github.com/alex-berlin-tv/radio-ingest/config"
+	"go.etcd.io/bbolt"
+)
+
+// Dependencies and settings handed to a [HandlerFactory].
+type HandlerEnv struct {
+	Omnia  OmniaClient
+	Router Router
+	DB     *bbolt.DB
+	// Handlers must not change anything in dry-run mode but report the
+	// intended changes instead.
+	DryRun bool
+	// Localized texts and templates for the messages of the handlers.
+	Messages Messages
+	// Cached list of all shows in Omnia.
+	Shows *ShowCatalog
+	// Broadcast schedules, loaded when the handlers are set up on startup.
+	Schedules *ScheduleCache
+	// Handler specific settings block from the config. Can be empty.
+	Settings json.RawMessage
+}
+
+// A notification which should be handled.
+type Incoming struct {
+	Notification notification.Notification
+	// Raw body of the notification.
+	Body []byte
+	// Requests the handler to bypass its checks for already handled items.
+	Force bool
+	// States whether the notification comes from the retry queue. Handlers
+	// must not ignore it because of its age.
+	Retry bool
+}
+
+// Creates a [Handler] for a single notification.
+type HandlerFactory func(env HandlerEnv, in Incoming) (Handler, error)
+
+var handlerRegistry = make(map[string]HandlerFactory)
+
+// Registers a handler factory under the given name. Handlers are enabled
+// using this name in the config. Meant to be called from init functions,
+// panics if the name is already taken.
+func RegisterHandler(name string, factory HandlerFactory) {
+	if _, ok := handlerRegistry[name]; ok {
+		panic(fmt.Sprintf("handler %s is already registered", name))
+	}
+	handlerRegistry[name] = factory
+}
+
+// Returns the names of all registered handlers.
+func RegisteredHandlers() []string {
+	var rsl []string
+	for name := range handlerRegistry {
+		rsl = append(rsl, name)
+	}
+	sort.Strings(rsl)
+	return rsl
+}
+
+// A handler enabled by the config.
+type enabledHandler struct {
+	Name     string
+	Factory  HandlerFactory
+	Settings json.RawMessage
+}
+
+// Looks up the factories of all enabled handlers in the given order. Fails if
+// a handler isn't registered.
+func enabledHandlers(cfgs []config.HandlerConfig) ([]enabledHandler, error) {
+	var rsl []enabledHandler
+	for _, cfg := range cfgs {
+		if !cfg.Enabled {
+			continue
+		}
+		factory, ok := handlerRegistry[cfg.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown handler %s in config, available handlers are %v", cfg.Name, RegisteredHandlers())
+		}
+		rsl = append(rsl, enabledHandler{
+			Name:     cfg.Name,
+			Factory:  factory,
+			Settings: cfg.Settings,
+		})
+	}
+	return rsl, nil
+}
@@ -0,0 +1,84 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/alex-berlin-tv/nexx_omnia_go/omnia/enums"
+	"github.com/alex-berlin-tv/nexx_omnia_go/omnia/params"
+)
+
+// Runs the complete task pipeline for an audio item again, regardless of
+// whether the item was already processed. The notification stored in the
+// processing record is replayed, as the first run cleared the fields the
+// tasks read. Items without record are handled based on their current
+// metadata in Omnia.
+func (d Daemon) Reprocess(id int) error {
+	body, err := d.reprocessBody(id)
+	if err != nil {
+		return err
+	}
+	handled, err := d.dispatch(Incoming{Body: body, Force: true})
+	if err != nil {
+		return err
+	}
+	if !handled {
+		return fmt.Errorf("item %d can't be handled by any enabled handler", id)
+	}
+	return nil
+}
+
+// Returns the notification body to process the item with.
+func (d Daemon) reprocessBody(id int) ([]byte, error) {
+	rec, err := loadProcessingRecord(d.DB, strconv.Itoa(id))
+	if err != nil {
+		return nil, err
+	}
+	if rec != nil && len(rec.Notification) != 0 {
+		return rec.Notification, nil
+	}
+	return d.syntheticNotification(id)
+}
+
+// Builds the body of a metadata notification for the given item based on its
+// current state in Omnia.
+func (d Daemon) syntheticNotification(id int) ([]byte, error) {
+	rsp, err := d.Omnia.ById(enums.AudioStreamType, id, params.Basic{NoCache: enums.YesBool})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch item %d from Omnia, %s", id, err)
+	}
+	if rsp.Result == nil {
+		return nil, fmt.Errorf("item %d not found in Omnia", id)
+	}
+	data, ok := (*rsp.Result).(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("unexpected result type %T for item %d", *rsp.Result, id)
+	}
+	general, _ := data["general"].(map[string]any)
+	publishing, ok := data["publishingdata"].(map[string]any)
+	if !ok {
+		publishing = make(map[string]any)
+		data["publishingdata"] = publishing
+	}
+	publishing["origin"] = "uploadlink"
+	domain, _ := strconv.Atoi(d.DomainId)
+	now := time.Now().Unix()
+	return json.Marshal(map[string]any{
+		"trigger": map[string]any{
+			"event":   "metadata",
+			"user":    0,
+			"session": 0,
+			"created": now,
+			"sent":    now,
+		},
+		"item": map[string]any{
+			"ID":         strconv.Itoa(id),
+			"GID":        general["GID"],
+			"domain":     domain,
+			"streamtype": "audio",
+		},
+		"data": data,
+	})
+}
@@ -0,0 +1,167 @@
+package daemon
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alex-berlin-tv/radio-ingest/config"
+	"github.com/alex-berlin-tv/radio-ingest/notifier"
+	"github.com/sirupsen/logrus"
+)
+
+// Information on a message used to pick its notifiers.
+type messageContext struct {
+	ShowID         int
+	Show           string
+	Producer       string
+	HasErrors      bool
+	HasManualTasks bool
+}
+
+// Returns the context of a message reporting the given task results.
+func newMessageContext(showID int, show string, producer string, rsl taskResults) messageContext {
+	return messageContext{
+		ShowID:         showID,
+		Show:           show,
+		Producer:       producer,
+		HasErrors:      len(rsl.errResults()) != 0,
+		HasManualTasks: len(rsl.manualTasks()) != 0,
+	}
+}
+
+// Picks the notifiers for a message based on the configured routes. Sends a
+// message to all notifiers when used as [notifier.Notifier] itself.
+type Router struct {
+	notifiers map[string]notifier.Notifier
+	// Names of the notifiers in the order of the config.
+	names  []string
+	routes []config.RouteConfig
+	// Notifiers for messages no route matches.
+	fallback []string
+}
+
+// Returns a new [Router] for the given notifiers, routes and fallback
+// notifiers. Fails if a route or the fallback refers to an unknown notifier.
+func NewRouter(cfgs []config.NotifierConfig, routes []config.RouteConfig, fallback []string) (*Router, error) {
+	rsl := Router{
+		notifiers: make(map[string]notifier.Notifier),
+		routes:    routes,
+		fallback:  fallback,
+	}
+	typeCount := make(map[string]int)
+	for _, cfg := range cfgs {
+		typeCount[cfg.Type]++
+	}
+	for i, cfg := range cfgs {
+		ntf, err := notifier.FromConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		name := cfg.Name
+		if name == "" && typeCount[cfg.Type] > 1 {
+			name = fmt.Sprintf("%s%d", cfg.Type, i+1)
+		} else if name == "" {
+			name = cfg.Type
+		}
+		if _, ok := rsl.notifiers[name]; ok {
+			return nil, fmt.Errorf("notifier name %s is used multiple times", name)
+		}
+		rsl.notifiers[name] = ntf
+		rsl.names = append(rsl.names, name)
+	}
+	for _, route := range routes {
+		for _, name := range route.Notifiers {
+			if _, ok := rsl.notifiers[name]; !ok {
+				return nil, fmt.Errorf("route refers to unknown notifier %s", name)
+			}
+		}
+		switch route.Outcome {
+		case "", "success", "error", "manual":
+		default:
+			return nil, fmt.Errorf("unknown outcome %s in route", route.Outcome)
+		}
+	}
+	for _, name := range fallback {
+		if _, ok := rsl.notifiers[name]; !ok {
+			return nil, fmt.Errorf("fallback refers to unknown notifier %s", name)
+		}
+	}
+	return &rsl, nil
+}
+
+// Sends the message to all notifiers.
+func (r Router) Send(msg string) error {
+	return r.multi(r.names).Send(msg)
+}
+
+// Returns the notifiers of all routes matching the message. If no route
+// matches, the fallback notifiers are returned. Without routes all notifiers
+// are returned.
+func (r Router) For(ctx messageContext) notifier.Multi {
+	if len(r.routes) == 0 {
+		return r.multi(r.names)
+	}
+	var names []string
+	for _, route := range r.routes {
+		if routeMatches(route, ctx) {
+			names = appendMissing(names, route.Notifiers...)
+		}
+	}
+	if len(names) == 0 {
+		if len(r.fallback) == 0 {
+			logrus.WithField("show", ctx.Show).Error("no route matches message and no fallback notifiers configured, message is dropped")
+		} else {
+			logrus.WithField("show", ctx.Show).Info("no route matches message, sending to fallback notifiers")
+		}
+		return r.multi(r.fallback)
+	}
+	return r.multi(names)
+}
+
+func (r Router) multi(names []string) notifier.Multi {
+	var rsl notifier.Multi
+	for _, name := range names {
+		rsl = append(rsl, notifier.Named{Name: name, Notifier: r.notifiers[name]})
+	}
+	return rsl
+}
+
+// States whether all criteria of a route are met by the message.
+func routeMatches(route config.RouteConfig, ctx messageContext) bool {
+	if len(route.Shows) != 0 {
+		found := false
+		for _, show := range route.Shows {
+			if (ctx.Show != "" && strings.EqualFold(show, ctx.Show)) ||
+				(ctx.ShowID != 0 && show == strconv.Itoa(ctx.ShowID)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(route.Producers) != 0 {
+		found := false
+		producer := strings.ToLower(ctx.Producer)
+		for _, name := range route.Producers {
+			if name != "" && strings.Contains(producer, strings.ToLower(name)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	switch route.Outcome {
+	case "success":
+		return !ctx.HasErrors && !ctx.HasManualTasks
+	case "error":
+		return ctx.HasErrors
+	case "manual":
+		return ctx.HasManualTasks
+	}
+	return true
+}
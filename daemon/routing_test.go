@@ -0,0 +1,80 @@
+package daemon
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alex-berlin-tv/nexx_omnia_go/notification"
+	"github.com/alex-berlin-tv/radio-ingest/config"
+)
+
+// Webhook counting the received messages, fails while failing is set.
+type testWebhook struct {
+	mu       sync.Mutex
+	received int
+	failing  bool
+}
+
+func (h *testWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.failing {
+		http.Error(w, "unavailable", http.StatusBadRequest)
+		return
+	}
+	h.received++
+}
+
+func (h *testWebhook) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.received
+}
+
+func TestResendRoutesByStoredProducer(t *testing.T) {
+	producerHook := &testWebhook{failing: true}
+	producerSrv := httptest.NewServer(producerHook)
+	defer producerSrv.Close()
+	fallbackHook := &testWebhook{}
+	fallbackSrv := httptest.NewServer(fallbackHook)
+	defer fallbackSrv.Close()
+	router, err := NewRouter([]config.NotifierConfig{
+		{Name: "producer", Type: "slack", URL: producerSrv.URL},
+		{Name: "fallback", Type: "slack", URL: fallbackSrv.URL},
+	}, []config.RouteConfig{
+		{Producers: []string{"Anna"}, Notifiers: []string{"producer"}},
+	}, []string{"fallback"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := newTestShows()
+	u := newTestUpload(t, fake, notification.GeneralData{
+		SubTitle:    "Anna Schmidt",
+		Description: time.Now().AddDate(0, 0, 10).Format("02.01.2006"),
+		RefNr:       "Kiezradio",
+	})
+	u.Router = *router
+	if err := u.OnNotification(); err == nil {
+		t.Fatal("delivery to the failing notifier succeeded")
+	}
+	// Omnia reports the item again after the update cleared the subtitle.
+	producerHook.mu.Lock()
+	producerHook.failing = false
+	producerHook.mu.Unlock()
+	u.Notification.Data.General.SubTitle = ""
+	if err := u.OnNotification(); err != nil {
+		t.Fatal(err)
+	}
+	if n := producerHook.count(); n != 1 {
+		t.Errorf("producer notifier received %d messages, want 1", n)
+	}
+	if n := fallbackHook.count(); n != 0 {
+		t.Errorf("fallback notifier received %d messages, want none", n)
+	}
+	if n := len(fake.CallsOf("Update")); n != 1 {
+		t.Errorf("%d updates, want 1", n)
+	}
+}
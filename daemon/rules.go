@@ -0,0 +1,135 @@
+package daemon
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alex-berlin-tv/nexx_omnia_go/notification"
+	"github.com/alex-berlin-tv/nexx_omnia_go/omnia/params"
+)
+
+// Declarative rule which writes a value to a field of the uploaded item. The
+// value is either taken from a field of the notification or given as a fixed
+// value.
+type FieldRule struct {
+	// Field of the notification the value is taken from. One of title,
+	// subtitle, description or refnr.
+	Source string `json:"source,omitempty"`
+	// Fixed value, used if no source is given.
+	Value string `json:"value,omitempty"`
+	// Omnia field the value is written to.
+	Target string `json:"target"`
+	// Optional transformation of the value. One of trim, lower or upper.
+	Transform string `json:"transform,omitempty"`
+	// Clears the source field after the value was written.
+	ClearSource bool `json:"clear_source,omitempty"`
+	// Hides the result in the message if the rule was applied successfully.
+	Omit bool `json:"omit,omitempty"`
+	// Message on success. Messages are either IDs of the message catalog or
+	// literal texts.
+	Result string `json:"result"`
+	// Message and manual tasks if the target couldn't be written.
+	ErrorResult string   `json:"error_result"`
+	ManualTasks []string `json:"manual_tasks,omitempty"`
+	// Additional manual tasks to clear the source if the update failed.
+	ClearManualTasks []string `json:"clear_manual_tasks,omitempty"`
+}
+
+var fieldTransforms = map[string]func(string) string{
+	"":      func(s string) string { return s },
+	"trim":  strings.TrimSpace,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// Checks the rule for unknown fields and transformations.
+func (r FieldRule) validate() error {
+	if r.Target == "" {
+		return fmt.Errorf("rule without target")
+	}
+	if r.Source != "" {
+		if _, ok := notificationField(notification.Notification{}, r.Source); !ok {
+			return fmt.Errorf("unknown source field %s in rule for %s", r.Source, r.Target)
+		}
+	} else if r.ClearSource {
+		return fmt.Errorf("rule for %s clears source but has no source", r.Target)
+	}
+	if _, ok := fieldTransforms[r.Transform]; !ok {
+		return fmt.Errorf("unknown transform %s in rule for %s", r.Transform, r.Target)
+	}
+	return nil
+}
+
+// Returns the value of a general field of the notification by its name.
+func notificationField(ntf notification.Notification, name string) (string, bool) {
+	general := ntf.Data.General
+	switch name {
+	case "title":
+		return general.Title, true
+	case "subtitle":
+		return general.SubTitle, true
+	case "description":
+		return general.Description, true
+	case "refnr":
+		return general.RefNr, true
+	}
+	return "", false
+}
+
+// Plans the changes of a field rule. Rules with an empty source field are
+// skipped, so processing an item again doesn't overwrite the target with the
+// already cleared source.
+func (u RadioUpload) planRule(rule FieldRule) plannedTask {
+	value := rule.Value
+	if rule.Source != "" {
+		value, _ = notificationField(u.Notification, rule.Source)
+		if strings.TrimSpace(value) == "" {
+			return resultOnlyTask(taskResult{
+				Success: true,
+				Omit:    true,
+				Result:  u.Messages.Text("source_empty", rule.Source),
+			})
+		}
+	}
+	fields := params.Custom{
+		rule.Target: fieldTransforms[rule.Transform](value),
+	}
+	manualTasks := u.Messages.Texts(rule.ManualTasks)
+	if rule.ClearSource {
+		fields[rule.Source] = ""
+		manualTasks = appendMissing(manualTasks, u.Messages.Texts(rule.ClearManualTasks)...)
+	}
+	return plannedTask{
+		Fields: fields,
+		Result: taskResult{
+			Success: true,
+			Omit:    rule.Omit,
+			Result:  u.Messages.Text(rule.Result),
+		},
+		Failure: func(err error) taskResult {
+			return taskResult{
+				Success:     false,
+				Result:      u.Messages.Text(rule.ErrorResult),
+				ManualTasks: manualTasks,
+			}
+		},
+	}
+}
+
+// Appends the values which aren't already part of the slice.
+func appendMissing(slice []string, values ...string) []string {
+	rsl := append([]string{}, slice...)
+	for _, value := range values {
+		found := false
+		for _, existing := range rsl {
+			if existing == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			rsl = append(rsl, value)
+		}
+	}
+	return rsl
+}
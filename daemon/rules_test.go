@@ -0,0 +1,92 @@
+package daemon
+
+import (
+	"testing"
+
+	"github.com/alex-berlin-tv/nexx_omnia_go/notification"
+	"github.com/alex-berlin-tv/nexx_omnia_go/omnia/params"
+)
+
+func TestPlanRule(t *testing.T) {
+	general := notification.GeneralData{
+		Title:       "Folge 12",
+		SubTitle:    "  Neues aus dem Kiez ",
+		Description: "",
+	}
+	tests := []struct {
+		name   string
+		rule   FieldRule
+		fields params.Custom
+		omit   bool
+	}{
+		{
+			name:   "fixed value",
+			rule:   FieldRule{Value: "31543", Target: "channel", Omit: true},
+			fields: params.Custom{"channel": "31543"},
+			omit:   true,
+		},
+		{
+			name:   "copy",
+			rule:   FieldRule{Source: "title", Target: "alttitle"},
+			fields: params.Custom{"alttitle": "Folge 12"},
+		},
+		{
+			name:   "move with transform",
+			rule:   FieldRule{Source: "subtitle", Target: "alttitle", Transform: "trim", ClearSource: true},
+			fields: params.Custom{"alttitle": "Neues aus dem Kiez", "subtitle": ""},
+		},
+		{
+			name:   "upper",
+			rule:   FieldRule{Source: "title", Target: "alttitle", Transform: "upper"},
+			fields: params.Custom{"alttitle": "FOLGE 12"},
+		},
+		{
+			name:   "empty source",
+			rule:   FieldRule{Source: "description", Target: "altdescription", ClearSource: true},
+			fields: nil,
+			omit:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := newTestUpload(t, newFakeOmnia(), general)
+			task := u.planRule(tt.rule)
+			if !task.Result.Success {
+				t.Errorf("rule failed: %s", task.Result.Result)
+			}
+			if task.Result.Omit != tt.omit {
+				t.Errorf("omit is %t, want %t", task.Result.Omit, tt.omit)
+			}
+			if len(task.Fields) != len(tt.fields) {
+				t.Fatalf("changes %v, want %v", task.Fields, tt.fields)
+			}
+			for field, want := range tt.fields {
+				if got := task.Fields[field]; got != want {
+					t.Errorf("field %s is '%v', want '%v'", field, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFieldRuleValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  FieldRule
+		valid bool
+	}{
+		{name: "fixed value", rule: FieldRule{Value: "1", Target: "channel"}, valid: true},
+		{name: "source", rule: FieldRule{Source: "subtitle", Target: "alttitle", ClearSource: true}, valid: true},
+		{name: "no target", rule: FieldRule{Value: "1"}, valid: false},
+		{name: "unknown source", rule: FieldRule{Source: "teaser", Target: "alttitle"}, valid: false},
+		{name: "clear without source", rule: FieldRule{Value: "1", Target: "channel", ClearSource: true}, valid: false},
+		{name: "unknown transform", rule: FieldRule{Source: "title", Target: "alttitle", Transform: "title"}, valid: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.validate(); (err == nil) != tt.valid {
+				t.Errorf("validate returned %v, want valid %t", err, tt.valid)
+			}
+		})
+	}
+}
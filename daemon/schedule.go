@@ -0,0 +1,439 @@
+package daemon
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Weekly broadcast schedule stating when each show airs.
+type Schedule struct {
+	Shows []ScheduledShow `json:"shows"`
+}
+
+// Recurring slots of a show. The show is identified by its Omnia ID or, if
+// no ID is given, by its title.
+type ScheduledShow struct {
+	ShowID int    `json:"show_id,omitempty"`
+	Show   string `json:"show,omitempty"`
+	Slots  []Slot `json:"slots"`
+}
+
+// A weekly slot in the schedule.
+type Slot struct {
+	// English or German name of the weekday or its two letter iCal code.
+	Weekday string `json:"weekday"`
+	// Start time as HH:MM.
+	Time string `json:"time"`
+	// Length of the slot in minutes.
+	Duration int `json:"duration,omitempty"`
+	weekday  time.Weekday
+	hour     int
+	minute   int
+}
+
+var scheduleWeekdays = map[string]time.Weekday{
+	"monday": time.Monday, "montag": time.Monday, "mo": time.Monday,
+	"tuesday": time.Tuesday, "dienstag": time.Tuesday, "tu": time.Tuesday, "di": time.Tuesday,
+	"wednesday": time.Wednesday, "mittwoch": time.Wednesday, "we": time.Wednesday, "mi": time.Wednesday,
+	"thursday": time.Thursday, "donnerstag": time.Thursday, "th": time.Thursday, "do": time.Thursday,
+	"friday": time.Friday, "freitag": time.Friday, "fr": time.Friday,
+	"saturday": time.Saturday, "samstag": time.Saturday, "sa": time.Saturday,
+	"sunday": time.Sunday, "sonntag": time.Sunday, "su": time.Sunday, "so": time.Sunday,
+}
+
+// Parses weekday and time of the slot.
+func (s *Slot) parse() error {
+	weekday, ok := scheduleWeekdays[strings.ToLower(strings.TrimSpace(s.Weekday))]
+	if !ok {
+		return fmt.Errorf("unknown weekday %s", s.Weekday)
+	}
+	start, err := time.Parse("15:04", s.Time)
+	if err != nil {
+		return fmt.Errorf("invalid time %s, has to be HH:MM", s.Time)
+	}
+	s.weekday = weekday
+	s.hour = start.Hour()
+	s.minute = start.Minute()
+	return nil
+}
+
+// Returns the start of the slot in the week of the given time.
+func (s Slot) inWeekOf(t time.Time) time.Time {
+	day := startOfDay(t).AddDate(0, 0, int(s.weekday)-int(t.Weekday()))
+	return time.Date(day.Year(), day.Month(), day.Day(), s.hour, s.minute, 0, 0, t.Location())
+}
+
+// Returns the first start of the slot at or after the given time.
+func (s Slot) next(after time.Time) time.Time {
+	rsl := s.inWeekOf(after)
+	for rsl.Before(after) {
+		rsl = rsl.AddDate(0, 0, 7)
+	}
+	return rsl
+}
+
+// States whether the date falls on the slot. Dates with time have to lie
+// within the slot, at its start if the slot has no duration. Dates without
+// time only have to match the weekday.
+func (s Slot) fits(date dateCandidate) bool {
+	if !date.HasTime {
+		return date.Date.Weekday() == s.weekday
+	}
+	length := time.Duration(s.Duration) * time.Minute
+	// Slots running past midnight may have started in the previous week.
+	for _, start := range []time.Time{s.inWeekOf(date.Date), s.inWeekOf(date.Date).AddDate(0, 0, -7)} {
+		if date.Date.Equal(start) || (date.Date.After(start) && date.Date.Before(start.Add(length))) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the schedule entry of the given show, nil if the show isn't part
+// of the schedule.
+func (s *Schedule) For(showID int, title string) *ScheduledShow {
+	if s == nil {
+		return nil
+	}
+	for i, show := range s.Shows {
+		if (show.ShowID != 0 && show.ShowID == showID) ||
+			(show.ShowID == 0 && show.Show != "" && strings.EqualFold(show.Show, title)) {
+			return &s.Shows[i]
+		}
+	}
+	return nil
+}
+
+// States whether the date falls on one of the slots of the show.
+func (s ScheduledShow) fits(date dateCandidate) bool {
+	for _, slot := range s.Slots {
+		if slot.fits(date) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the length of the slot the date falls on. Without a matching slot
+// the length is only known if all slots of the show have the same length.
+// Returns zero if the length is unknown.
+func (s ScheduledShow) length(date *dateCandidate) time.Duration {
+	if date != nil {
+		for _, slot := range s.Slots {
+			if slot.fits(*date) {
+				return time.Duration(slot.Duration) * time.Minute
+			}
+		}
+	}
+	var rsl int
+	for i, slot := range s.Slots {
+		if i != 0 && slot.Duration != rsl {
+			return 0
+		}
+		rsl = slot.Duration
+	}
+	return time.Duration(rsl) * time.Minute
+}
+
+// Returns the slot start closest to the given date. On a tie the later slot
+// is preferred, as producers tend to enter the recording date.
+func (s ScheduledShow) nearest(date time.Time) (time.Time, *Slot) {
+	var rsl time.Time
+	var rslSlot *Slot
+	var best time.Duration
+	for i, slot := range s.Slots {
+		for _, start := range []time.Time{slot.next(date), slot.next(date).AddDate(0, 0, -7)} {
+			diff := start.Sub(date)
+			if diff < 0 {
+				diff = -diff
+			}
+			if rslSlot == nil || diff < best || (diff == best && start.After(rsl)) {
+				rsl, rslSlot, best = start, &s.Slots[i], diff
+			}
+		}
+	}
+	return rsl, rslSlot
+}
+
+// Returns the first slot start after the given time which isn't taken. A
+// slot is taken if one of the taken dates falls on the same day, as dates
+// entered without time are stored as midnight. Slots after the limit aren't
+// considered, a zero limit allows up to a year.
+func (s ScheduledShow) nextFree(after time.Time, limit time.Time, taken []time.Time) (time.Time, bool) {
+	if limit.IsZero() {
+		limit = after.AddDate(1, 0, 0)
+	}
+	isTaken := func(t time.Time) bool {
+		for _, other := range taken {
+			if startOfDay(other.In(t.Location())).Equal(startOfDay(t)) {
+				return true
+			}
+		}
+		return false
+	}
+	var rsl time.Time
+	found := false
+	for _, slot := range s.Slots {
+		for start := slot.next(after); !start.After(limit); start = start.AddDate(0, 0, 7) {
+			if isTaken(start) {
+				continue
+			}
+			if !found || start.Before(rsl) {
+				rsl = start
+				found = true
+			}
+			break
+		}
+	}
+	return rsl, found
+}
+
+// Schedules shared by all handlers, each file is only loaded once.
+type ScheduleCache struct {
+	mu        sync.Mutex
+	schedules map[string]*Schedule
+}
+
+func NewScheduleCache() *ScheduleCache {
+	return &ScheduleCache{schedules: make(map[string]*Schedule)}
+}
+
+// Returns the schedule of the given file, loads it on the first call. Without
+// cache the file is loaded on every call.
+func (c *ScheduleCache) Load(path string, loc *time.Location) (*Schedule, error) {
+	if c == nil {
+		return LoadSchedule(path, loc)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := path + "|" + loc.String()
+	if rsl, ok := c.schedules[key]; ok {
+		return rsl, nil
+	}
+	rsl, err := LoadSchedule(path, loc)
+	if err != nil {
+		return nil, err
+	}
+	c.schedules[key] = rsl
+	return rsl, nil
+}
+
+// Loads a schedule from a JSON or iCal file, chosen by the file extension
+// (.ics for iCal). Times without time zone are interpreted in the given
+// location.
+func LoadSchedule(path string, loc *time.Location) (*Schedule, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load schedule, %s", err)
+	}
+	var rsl *Schedule
+	if strings.EqualFold(filepath.Ext(path), ".ics") {
+		rsl, err = parseICalSchedule(raw, loc)
+	} else {
+		rsl = &Schedule{}
+		err = json.Unmarshal(raw, rsl)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %s, %s", path, err)
+	}
+	for i := range rsl.Shows {
+		show := &rsl.Shows[i]
+		if show.ShowID == 0 && show.Show == "" {
+			return nil, fmt.Errorf("schedule entry without show_id and show")
+		}
+		for j := range show.Slots {
+			if err := show.Slots[j].parse(); err != nil {
+				return nil, fmt.Errorf("invalid slot of show %s%d in schedule, %s", show.Show, show.ShowID, err)
+			}
+		}
+	}
+	return rsl, nil
+}
+
+// Parses the subset of iCal used for weekly schedules: VEVENTs with the show
+// title as SUMMARY, DTSTART, DTEND or DURATION and an RRULE with FREQ=WEEKLY
+// and optionally BYDAY. Events without recurrence (e.g. a special broadcast)
+// are ignored, other recurrences are rejected.
+func parseICalSchedule(raw []byte, loc *time.Location) (*Schedule, error) {
+	rsl := &Schedule{}
+	byTitle := make(map[string]*ScheduledShow)
+	var order []string
+	var event map[string]icalProperty
+	for _, line := range unfoldICal(raw) {
+		switch {
+		case line == "BEGIN:VEVENT":
+			event = make(map[string]icalProperty)
+		case line == "END:VEVENT":
+			if event == nil {
+				continue
+			}
+			title, slots, err := icalEventSlots(event, loc)
+			if err != nil {
+				return nil, err
+			}
+			if title != "" && len(slots) != 0 {
+				if _, ok := byTitle[title]; !ok {
+					byTitle[title] = &ScheduledShow{Show: title}
+					order = append(order, title)
+				}
+				byTitle[title].Slots = append(byTitle[title].Slots, slots...)
+			}
+			event = nil
+		case event != nil:
+			prop := parseICalProperty(line)
+			event[prop.Name] = prop
+		}
+	}
+	for _, title := range order {
+		rsl.Shows = append(rsl.Shows, *byTitle[title])
+	}
+	return rsl, nil
+}
+
+// A content line of an iCal file.
+type icalProperty struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// Joins folded lines, continuation lines start with a space or tab.
+func unfoldICal(raw []byte) []string {
+	var rsl []string
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(rsl) != 0 {
+			rsl[len(rsl)-1] += line[1:]
+			continue
+		}
+		rsl = append(rsl, line)
+	}
+	return rsl
+}
+
+func parseICalProperty(line string) icalProperty {
+	rsl := icalProperty{Params: make(map[string]string)}
+	head, value, _ := strings.Cut(line, ":")
+	rsl.Value = value
+	parts := strings.Split(head, ";")
+	rsl.Name = strings.ToUpper(parts[0])
+	for _, part := range parts[1:] {
+		key, val, _ := strings.Cut(part, "=")
+		rsl.Params[strings.ToUpper(key)] = val
+	}
+	return rsl
+}
+
+// Returns the show title and the weekly slots of an event. Events without
+// recurrence have no slots.
+func icalEventSlots(event map[string]icalProperty, loc *time.Location) (string, []Slot, error) {
+	title := strings.TrimSpace(strings.ReplaceAll(event["SUMMARY"].Value, `\,`, ","))
+	dtStart, ok := event["DTSTART"]
+	if !ok {
+		return "", nil, nil
+	}
+	rrule, ok := event["RRULE"]
+	if !ok {
+		return "", nil, nil
+	}
+	start, err := parseICalTime(dtStart, loc)
+	if err != nil {
+		return "", nil, err
+	}
+	duration := 0
+	if dtEnd, ok := event["DTEND"]; ok {
+		end, err := parseICalTime(dtEnd, loc)
+		if err != nil {
+			return "", nil, err
+		}
+		duration = int(end.Sub(start).Minutes())
+	} else if dur, ok := event["DURATION"]; ok {
+		duration, err = parseICalDuration(dur.Value)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	weekdays := []string{icalWeekday(start.Weekday())}
+	rules := make(map[string]string)
+	for _, part := range strings.Split(rrule.Value, ";") {
+		key, val, _ := strings.Cut(part, "=")
+		rules[strings.ToUpper(key)] = strings.ToUpper(val)
+	}
+	if rules["FREQ"] != "WEEKLY" {
+		return "", nil, fmt.Errorf("event %s repeats %s, only weekly events are supported", title, rules["FREQ"])
+	}
+	if byDay := rules["BYDAY"]; byDay != "" {
+		weekdays = strings.Split(byDay, ",")
+	}
+	var slots []Slot
+	for _, weekday := range weekdays {
+		slots = append(slots, Slot{
+			Weekday:  weekday,
+			Time:     start.Format("15:04"),
+			Duration: duration,
+		})
+	}
+	return title, slots, nil
+}
+
+// Parses DTSTART and DTEND values in UTC, with TZID or as floating time.
+func parseICalTime(prop icalProperty, loc *time.Location) (time.Time, error) {
+	if strings.HasSuffix(prop.Value, "Z") {
+		rsl, err := time.Parse("20060102T150405Z", prop.Value)
+		return rsl.In(loc), err
+	}
+	if tzid := prop.Params["TZID"]; tzid != "" {
+		if tz, err := time.LoadLocation(tzid); err == nil {
+			rsl, err := time.ParseInLocation("20060102T150405", prop.Value, tz)
+			return rsl.In(loc), err
+		}
+	}
+	if len(prop.Value) == len("20060102") {
+		return time.ParseInLocation("20060102", prop.Value, loc)
+	}
+	return time.ParseInLocation("20060102T150405", prop.Value, loc)
+}
+
+// Parses durations like PT1H30M into minutes.
+func parseICalDuration(value string) (int, error) {
+	rest := strings.TrimPrefix(strings.TrimPrefix(value, "P"), "T")
+	rsl := 0
+	num := ""
+	for _, r := range rest {
+		switch {
+		case r >= '0' && r <= '9':
+			num += string(r)
+		case r == 'T':
+		case r == 'D' || r == 'H' || r == 'M' || r == 'S':
+			n, err := strconv.Atoi(num)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %s", value)
+			}
+			switch r {
+			case 'D':
+				rsl += n * 24 * 60
+			case 'H':
+				rsl += n * 60
+			case 'M':
+				rsl += n
+			}
+			num = ""
+		default:
+			return 0, fmt.Errorf("invalid duration %s", value)
+		}
+	}
+	return rsl, nil
+}
+
+func icalWeekday(weekday time.Weekday) string {
+	return []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}[weekday]
+}
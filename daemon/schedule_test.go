@@ -0,0 +1,129 @@
+package daemon
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseICalSchedule(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		event string
+		// Expected slots as "weekday time duration", none if the event is
+		// ignored.
+		slots []string
+		// Expected show title, Kiezradio if empty.
+		title string
+		fails bool
+	}{
+		{
+			name: "weekly with end",
+			event: `SUMMARY:Kiezradio
+DTSTART:20260105T180000
+DTEND:20260105T190000
+RRULE:FREQ=WEEKLY`,
+			slots: []string{"MO 18:00 60"},
+		},
+		{
+			name: "duration",
+			event: `SUMMARY:Kiezradio
+DTSTART:20260105T180000
+DURATION:PT1H30M
+RRULE:FREQ=WEEKLY`,
+			slots: []string{"MO 18:00 90"},
+		},
+		{
+			name: "byday",
+			event: `SUMMARY:Kiezradio
+DTSTART:20260106T200000
+DURATION:PT30M
+RRULE:FREQ=WEEKLY;BYDAY=TU,FR`,
+			slots: []string{"TU 20:00 30", "FR 20:00 30"},
+		},
+		{
+			name: "utc",
+			event: `SUMMARY:Kiezradio
+DTSTART:20260105T170000Z
+DTEND:20260105T180000Z
+RRULE:FREQ=WEEKLY`,
+			slots: []string{"MO 18:00 60"},
+		},
+		{
+			name: "tzid",
+			event: `SUMMARY:Kiezradio
+DTSTART;TZID=Europe/London:20260105T170000
+DTEND;TZID=Europe/London:20260105T180000
+RRULE:FREQ=WEEKLY`,
+			slots: []string{"MO 18:00 60"},
+		},
+		{
+			name:  "folded lines",
+			event: "SUMMARY:Kultur am\r\n  Abend\r\nDTSTART:20260105T180000\r\nDTEND:20260105T19\r\n 0000\r\nRRULE:FREQ=WEEK\r\n\tLY;BYDAY=WE",
+			slots: []string{"WE 18:00 60"},
+			title: "Kultur am Abend",
+		},
+		{
+			name: "one-off event ignored",
+			event: `SUMMARY:Kiezradio Spezial
+DTSTART:20260105T180000
+DTEND:20260105T190000`,
+		},
+		{
+			name: "daily rejected",
+			event: `SUMMARY:Kiezradio
+DTSTART:20260105T180000
+DTEND:20260105T190000
+RRULE:FREQ=DAILY`,
+			fails: true,
+		},
+		{
+			name: "invalid duration",
+			event: `SUMMARY:Kiezradio
+DTSTART:20260105T180000
+DURATION:PT1X
+RRULE:FREQ=WEEKLY`,
+			fails: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := "BEGIN:VCALENDAR\nVERSION:2.0\nBEGIN:VEVENT\n" + tt.event + "\nEND:VEVENT\nEND:VCALENDAR\n"
+			schedule, err := parseICalSchedule([]byte(raw), loc)
+			if (err != nil) != tt.fails {
+				t.Fatalf("got error %v, want failure %t", err, tt.fails)
+			}
+			if tt.fails {
+				return
+			}
+			if len(tt.slots) == 0 {
+				if len(schedule.Shows) != 0 {
+					t.Errorf("got shows %v, want none", schedule.Shows)
+				}
+				return
+			}
+			if len(schedule.Shows) != 1 {
+				t.Fatalf("got %d shows, want 1", len(schedule.Shows))
+			}
+			title := tt.title
+			if title == "" {
+				title = "Kiezradio"
+			}
+			if schedule.Shows[0].Show != title {
+				t.Errorf("got show %s, want %s", schedule.Shows[0].Show, title)
+			}
+			var slots []string
+			for _, slot := range schedule.Shows[0].Slots {
+				slots = append(slots, strings.Join([]string{slot.Weekday, slot.Time, strconv.Itoa(slot.Duration)}, " "))
+			}
+			if strings.Join(slots, "|") != strings.Join(tt.slots, "|") {
+				t.Errorf("got slots %q, want %q", slots, tt.slots)
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package daemon
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/alex-berlin-tv/nexx_omnia_go/omnia"
+)
+
+// Compares the show name given by the uploader with the title of a show.
+// Returns a score between 0 (no similarity) and 1 (identical).
+type showScorer func(name string, title string) float64
+
+var showScorers = map[string]showScorer{
+	"levenshtein": levenshteinScore,
+	"token_set":   tokenSetScore,
+	"trigram":     trigramScore,
+}
+
+// Settings for matching the show name given by the uploader with the shows
+// in Omnia.
+type ShowMatchSettings struct {
+	// Scoring strategy. One of levenshtein, token_set or trigram.
+	Strategy string `json:"strategy"`
+	// Minimal score between 0 and 1 for a show to be linked.
+	Threshold float64 `json:"threshold"`
+	// If the second best show scores within this margin of the best one,
+	// the match is considered ambiguous and no show is linked.
+	TieMargin float64 `json:"tie_margin"`
+	// Number of candidates reported in the message.
+	Candidates int `json:"candidates"`
+}
+
+// Returns the default settings for show matching.
+func DefaultShowMatchSettings() ShowMatchSettings {
+	return ShowMatchSettings{
+		Strategy:   "token_set",
+		Threshold:  0.75,
+		TieMargin:  0.05,
+		Candidates: 3,
+	}
+}
+
+// Checks for an unknown strategy and values out of range.
+func (s ShowMatchSettings) validate() error {
+	if _, ok := showScorers[s.Strategy]; !ok {
+		return fmt.Errorf("unknown show matching strategy %s", s.Strategy)
+	}
+	if s.Threshold < 0 || s.Threshold > 1 {
+		return fmt.Errorf("show matching threshold has to be between 0 and 1")
+	}
+	if s.TieMargin < 0 {
+		return fmt.Errorf("show matching tie margin can't be negative")
+	}
+	return nil
+}
+
+// A show with its similarity to the given show name.
+type showCandidate struct {
+	ID    int     `json:"id"`
+	Title string  `json:"title"`
+	Score float64 `json:"score"`
+	// Registered alias which matched the show name, if any.
+	Alias string `json:"alias,omitempty"`
+	show  omnia.MediaResultItem
+}
+
+// Formats the candidate as title with the score in percent.
+func (c showCandidate) String() string {
+	return fmt.Sprintf("%s (%.0f%%)", c.Title, c.Score*100)
+}
+
+// Returns the candidates as a comma separated list.
+func formatCandidates(candidates []showCandidate) string {
+	var rsl []string
+	for _, candidate := range candidates {
+		rsl = append(rsl, candidate.String())
+	}
+	return strings.Join(rsl, ", ")
+}
+
+// Returns the candidates scoring at least the given minimum.
+func candidatesAbove(candidates []showCandidate, min float64) []showCandidate {
+	var rsl []showCandidate
+	for _, candidate := range candidates {
+		if candidate.Score >= min {
+			rsl = append(rsl, candidate)
+		}
+	}
+	return rsl
+}
+
+// Scores all shows against the name and returns them ordered by score, best
+// first.
+func rankShows(name string, shows []omnia.MediaResultItem, settings ShowMatchSettings) []showCandidate {
+	scorer := showScorers[settings.Strategy]
+	normName := normalizeShowName(name)
+	var rsl []showCandidate
+	for _, show := range shows {
+		rsl = append(rsl, showCandidate{
+			ID:    show.General.Id,
+			Title: show.General.Title,
+			Score: scorer(normName, normalizeShowName(show.General.Title)),
+			show:  show,
+		})
+	}
+	sort.SliceStable(rsl, func(i, j int) bool {
+		return rsl[i].Score > rsl[j].Score
+	})
+	return rsl
+}
+
+// Returns the number of candidates to report, as given by the settings.
+func (s ShowMatchSettings) reported(candidates []showCandidate) []showCandidate {
+	if s.Candidates > 0 && len(candidates) > s.Candidates {
+		return candidates[:s.Candidates]
+	}
+	return candidates
+}
+
+// Lower cases the name, replaces punctuation with spaces and collapses
+// whitespace.
+func normalizeShowName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return ' '
+	}, name)
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// Similarity based on the edit distance relative to the longer string.
+func levenshteinScore(a string, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	maxLen := len(ra)
+	if len(rb) > maxLen {
+		maxLen = len(rb)
+	}
+	if maxLen == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(maxLen)
+}
+
+// Returns the number of insertions, deletions and substitutions needed to
+// turn a into b.
+func levenshtein(a []rune, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(values ...int) int {
+	rsl := values[0]
+	for _, value := range values[1:] {
+		if value < rsl {
+			rsl = value
+		}
+	}
+	return rsl
+}
+
+// Similarity of the words regardless of their order and duplicates. The
+// common words are compared with the common words plus the remaining words
+// of each side, the best edit distance score is used. Tolerates typos as
+// well as additional or missing words. If one side only consists of some
+// words of the other, the score is reduced by the ratio of their lengths, so
+// a single common word isn't a full match.
+func tokenSetScore(a string, b string) float64 {
+	tokensA, tokensB := tokenSet(a), tokenSet(b)
+	var common, onlyA, onlyB []string
+	for token := range tokensA {
+		if tokensB[token] {
+			common = append(common, token)
+		} else {
+			onlyA = append(onlyA, token)
+		}
+	}
+	for token := range tokensB {
+		if !tokensA[token] {
+			onlyB = append(onlyB, token)
+		}
+	}
+	sort.Strings(common)
+	sort.Strings(onlyA)
+	sort.Strings(onlyB)
+	base := strings.Join(common, " ")
+	withA := strings.TrimSpace(base + " " + strings.Join(onlyA, " "))
+	withB := strings.TrimSpace(base + " " + strings.Join(onlyB, " "))
+	rsl := levenshteinScore(withA, withB)
+	if base != "" {
+		ratio := lengthRatio(withA, withB)
+		if score := levenshteinScore(base, withA) * ratio; score > rsl {
+			rsl = score
+		}
+		if score := levenshteinScore(base, withB) * ratio; score > rsl {
+			rsl = score
+		}
+	}
+	return rsl
+}
+
+// Returns the length of the shorter string relative to the longer one.
+func lengthRatio(a string, b string) float64 {
+	lenA, lenB := len([]rune(a)), len([]rune(b))
+	if lenA == lenB {
+		return 1
+	}
+	if lenA > lenB {
+		lenA, lenB = lenB, lenA
+	}
+	return float64(lenA) / float64(lenB)
+}
+
+func tokenSet(s string) map[string]bool {
+	rsl := make(map[string]bool)
+	for _, token := range strings.Fields(s) {
+		rsl[token] = true
+	}
+	return rsl
+}
+
+// Dice coefficient of the character trigrams of both strings.
+func trigramScore(a string, b string) float64 {
+	gramsA, gramsB := trigrams(a), trigrams(b)
+	if len(gramsA) == 0 && len(gramsB) == 0 {
+		return 1
+	}
+	common := 0
+	for gram, count := range gramsA {
+		common += minInt(count, gramsB[gram])
+	}
+	total := 0
+	for _, count := range gramsA {
+		total += count
+	}
+	for _, count := range gramsB {
+		total += count
+	}
+	return 2 * float64(common) / float64(total)
+}
+
+// Returns the trigrams of the string padded with spaces and their count.
+func trigrams(s string) map[string]int {
+	rsl := make(map[string]int)
+	if s == "" {
+		return rsl
+	}
+	runes := []rune("  " + s + " ")
+	for i := 0; i+3 <= len(runes); i++ {
+		rsl[string(runes[i:i+3])]++
+	}
+	return rsl
+}
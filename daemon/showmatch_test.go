@@ -0,0 +1,49 @@
+package daemon
+
+import (
+	"testing"
+
+	"github.com/alex-berlin-tv/nexx_omnia_go/omnia"
+)
+
+func TestTokenSetScore(t *testing.T) {
+	tests := []struct {
+		a   string
+		b   string
+		min float64
+		max float64
+	}{
+		{a: "kiezradio", b: "kiezradio", min: 1, max: 1},
+		{a: "abend kultur am", b: "kultur am abend", min: 1, max: 1},
+		{a: "kiezradoi", b: "kiezradio", min: 0.75, max: 0.8},
+		{a: "abend", b: "kultur am abend", min: 0, max: 0.5},
+		{a: "kiezradio folge 12", b: "kiezradio", min: 0, max: 0.75},
+		{a: "morgenmagazin", b: "kiezradio", min: 0, max: 0.3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+"/"+tt.b, func(t *testing.T) {
+			if score := tokenSetScore(tt.a, tt.b); score < tt.min || score > tt.max {
+				t.Errorf("score is %.2f, want %.2f to %.2f", score, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestRankShowsKeepsAllCandidates(t *testing.T) {
+	var shows []omnia.MediaResultItem
+	for i, title := range []string{"Kiezradio", "Kiezradio Spezial", "Kiezgeflüster", "Kultur am Abend"} {
+		shows = append(shows, omnia.MediaResultItem{General: omnia.MediaResultGeneral{Id: i + 1, Title: title}})
+	}
+	settings := DefaultShowMatchSettings()
+	settings.Candidates = 1
+	candidates := rankShows("Kiezradio", shows, settings)
+	if len(candidates) != len(shows) {
+		t.Fatalf("%d candidates, want all %d shows", len(candidates), len(shows))
+	}
+	if candidates[0].ID != 1 {
+		t.Errorf("best candidate is %d, want 1", candidates[0].ID)
+	}
+	if reported := settings.reported(candidates); len(reported) != 1 {
+		t.Errorf("%d reported candidates, want 1", len(reported))
+	}
+}
@@ -0,0 +1,232 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/alex-berlin-tv/nexx_omnia_go/omnia"
+	"github.com/alex-berlin-tv/nexx_omnia_go/omnia/enums"
+	"github.com/alex-berlin-tv/nexx_omnia_go/omnia/params"
+	"github.com/sirupsen/logrus"
+	"go.etcd.io/bbolt"
+)
+
+const (
+	showCatalogBucket = "ShowCatalog"
+	showCatalogKey    = "shows"
+	// Number of shows requested per page.
+	showPageSize = 100
+	// Interval in which the catalog checks whether a refresh is due.
+	showCatalogCheckInterval = time.Minute
+	// Delay after the first failed refresh. Doubles with each failure up to
+	// the refresh interval.
+	showCatalogRetryDelay = time.Minute
+)
+
+// Cached list of all shows in Omnia. The list is refreshed in the background
+// by [ShowCatalog.Run] once it is older than the interval and persisted to
+// the DB, so the daemon can start while Omnia isn't reachable. Failed
+// refreshes are retried with an exponential backoff.
+type ShowCatalog struct {
+	Omnia    OmniaClient
+	DB       *bbolt.DB
+	Interval time.Duration
+	// Keeps refreshed lists in memory only, used in dry-run mode.
+	ReadOnly bool
+	mu       sync.RWMutex
+	// Serializes the refreshes so concurrent handlers don't fetch the list
+	// at the same time.
+	refreshMu sync.Mutex
+	shows     []omnia.MediaResultItem
+	updated   time.Time
+	// Time of the last refresh attempt and number of failed attempts since
+	// the last successful refresh.
+	attempted time.Time
+	failures  int
+	// States whether the list is refreshed in the background.
+	running bool
+}
+
+// Persisted state of the [ShowCatalog].
+type showCatalogState struct {
+	Updated time.Time               `json:"updated"`
+	Shows   []omnia.MediaResultItem `json:"shows"`
+}
+
+// Returns a new [ShowCatalog] initialized with the shows persisted in the DB.
+func NewShowCatalog(omnia OmniaClient, db *bbolt.DB, interval time.Duration) (*ShowCatalog, error) {
+	rsl := &ShowCatalog{
+		Omnia:    omnia,
+		DB:       db,
+		Interval: interval,
+	}
+	err := db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(showCatalogBucket))
+		if bucket == nil {
+			return nil
+		}
+		dt := bucket.Get([]byte(showCatalogKey))
+		if dt == nil {
+			return nil
+		}
+		var state showCatalogState
+		if err := json.Unmarshal(dt, &state); err != nil {
+			return fmt.Errorf("invalid persisted show catalog, %s", err)
+		}
+		rsl.shows = state.Shows
+		rsl.updated = state.Updated
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rsl, nil
+}
+
+// Returns all shows. The list is only fetched on access if there is none yet
+// or if it isn't refreshed in the background (e.g. for CLI commands) and is
+// outdated. If the refresh fails, the outdated list is used.
+func (c *ShowCatalog) Shows() ([]omnia.MediaResultItem, error) {
+	c.mu.RLock()
+	shows, updated, running := c.shows, c.updated, c.running
+	c.mu.RUnlock()
+	if shows != nil && (running || time.Since(updated) < c.Interval) {
+		return shows, nil
+	}
+	err := c.refreshIfDue()
+	c.mu.RLock()
+	shows = c.shows
+	c.mu.RUnlock()
+	if shows == nil {
+		if err == nil {
+			err = fmt.Errorf("show catalog is empty, last refresh failed")
+		}
+		return nil, err
+	}
+	if err != nil {
+		logrus.Warnf("failed to refresh show catalog, using shows from %s, %s", updated.Format(time.RFC3339), err)
+	}
+	return shows, nil
+}
+
+// Refreshes the list whenever it's outdated until the done channel is
+// closed.
+func (c *ShowCatalog) Run(done <-chan struct{}) {
+	c.mu.Lock()
+	c.running = true
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.running = false
+		c.mu.Unlock()
+	}()
+	ticker := time.NewTicker(showCatalogCheckInterval)
+	defer ticker.Stop()
+	for {
+		if err := c.refreshIfDue(); err != nil {
+			logrus.Warnf("failed to refresh show catalog, %s", err)
+		}
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refreshes the list if it's outdated and the backoff after failed attempts
+// has passed.
+func (c *ShowCatalog) refreshIfDue() error {
+	c.mu.RLock()
+	due := c.shows == nil || time.Since(c.updated) >= c.Interval
+	waiting := c.failures > 0 && time.Since(c.attempted) < c.retryDelay()
+	c.mu.RUnlock()
+	if !due || waiting {
+		return nil
+	}
+	return c.Refresh()
+}
+
+// Returns the delay before the next attempt after failed refreshes.
+func (c *ShowCatalog) retryDelay() time.Duration {
+	rsl := showCatalogRetryDelay
+	for i := 1; i < c.failures && rsl < c.Interval; i++ {
+		rsl *= 2
+	}
+	if rsl > c.Interval {
+		return c.Interval
+	}
+	return rsl
+}
+
+// Returns the number of shows and the time of the last successful refresh.
+func (c *ShowCatalog) Status() (int, time.Time) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.shows), c.updated
+}
+
+// Fetches all shows from Omnia and persists them unless the catalog is read
+// only.
+func (c *ShowCatalog) Refresh() error {
+	start := time.Now()
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	c.mu.RLock()
+	refreshed := c.updated.After(start)
+	c.mu.RUnlock()
+	if refreshed {
+		return nil
+	}
+	shows, err := fetchAllShows(c.Omnia)
+	now := time.Now()
+	c.mu.Lock()
+	c.attempted = now
+	if err != nil {
+		c.failures++
+		c.mu.Unlock()
+		return err
+	}
+	c.failures = 0
+	c.shows = shows
+	c.updated = now
+	c.mu.Unlock()
+	logrus.WithField("shows", len(shows)).Debug("refreshed show catalog")
+	if c.ReadOnly {
+		return nil
+	}
+	dt, err := json.Marshal(showCatalogState{Updated: now, Shows: shows})
+	if err != nil {
+		return err
+	}
+	return c.DB.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(showCatalogBucket))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(showCatalogKey), dt)
+	})
+}
+
+// Pages through all shows in Omnia.
+func fetchAllShows(clt OmniaClient) ([]omnia.MediaResultItem, error) {
+	rsl := []omnia.MediaResultItem{}
+	for {
+		rsp, err := clt.All(enums.ShowStreamType, params.Basic{
+			Start: len(rsl),
+			Limit: showPageSize,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get list of shows, %s", err)
+		}
+		if rsp.Result == nil || len(*rsp.Result) == 0 {
+			return rsl, nil
+		}
+		rsl = append(rsl, *rsp.Result...)
+		if rsp.Paging == nil || len(rsl) >= rsp.Paging.ResultCount {
+			return rsl, nil
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package daemon
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.etcd.io/bbolt"
+)
+
+// Searches the RadioUpload bucket for items which are still in the processing
+// state. As only one daemon can access the DB at a time, such entries are
+// leftovers of an interrupted run. These items are marked as failed and an
+// alert listing the item IDs is sent to the notifiers. As notifications for
+// items older than a day are ignored, the alert asks the editors to
+// reprocess the items.
+func (d Daemon) resetStaleUploads() error {
+	var ids []string
+	err := d.DB.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(radioUploadBucket))
+		if err != nil {
+			return err
+		}
+		stale := make(map[string]ProcessingRecord)
+		err = bucket.ForEach(func(k, v []byte) error {
+			rec, err := processingRecordFromBytes(string(k), v)
+			if err != nil {
+				logrus.Errorf("invalid processing record for %s, %s", k, err)
+				return nil
+			}
+			if rec.Status == statusProcessing {
+				ids = append(ids, rec.ItemID)
+				stale[rec.ItemID] = *rec
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for id, rec := range stale {
+			rec.Version = processingRecordVersion
+			rec.Status = statusFailed
+			rec.MessageError = "processing was interrupted"
+			rec.Updated = time.Now()
+			dt, err := json.Marshal(rec)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(id), dt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	logrus.WithField("items", ids).Warn("found uploads stuck in processing state")
+	msg, err := d.Messages.Stale(ids)
+	if err != nil {
+		return err
+	}
+	return d.Router.For(messageContext{HasErrors: true, HasManualTasks: true}).Send(msg)
+}
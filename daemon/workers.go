@@ -0,0 +1,152 @@
+package daemon
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// A job for the [workerPool].
+type job struct {
+	// Jobs with the same key are always handled by the same worker and thus
+	// never run concurrently.
+	Key  string
+	Body []byte
+}
+
+// Processes notification bodies in the background using a fixed number of
+// workers. Allows to acknowledge incoming notifications immediately.
+type workerPool struct {
+	queues  []chan job
+	pending func([]byte)
+	wg      *sync.WaitGroup
+	mu      *sync.RWMutex
+	closed  bool
+	quit    chan struct{}
+}
+
+// Returns a new [workerPool] with the given number of workers, each buffering
+// up to size jobs. Starts the workers right away. Jobs are handled by fn,
+// jobs still waiting in the queue when the pool is closed are handed to
+// pending instead.
+func newWorkerPool(workers int, size int, fn func([]byte), pending func([]byte)) *workerPool {
+	if workers < 1 {
+		workers = 1
+	}
+	rsl := workerPool{
+		queues:  make([]chan job, workers),
+		pending: pending,
+		wg:      &sync.WaitGroup{},
+		mu:      &sync.RWMutex{},
+		quit:    make(chan struct{}),
+	}
+	for i := range rsl.queues {
+		rsl.queues[i] = make(chan job, size)
+		rsl.wg.Add(1)
+		go func(queue chan job) {
+			defer rsl.wg.Done()
+			for j := range queue {
+				select {
+				case <-rsl.quit:
+					pending(j.Body)
+				default:
+					fn(j.Body)
+				}
+			}
+		}(rsl.queues[i])
+	}
+	return &rsl
+}
+
+// Hands a job to the responsible worker. Returns false if the queue of the
+// worker is full or the pool is closed.
+func (p *workerPool) Submit(j job) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return false
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(j.Key))
+	select {
+	case p.queues[hash.Sum32()%uint32(len(p.queues))] <- j:
+		return true
+	default:
+		return false
+	}
+}
+
+// Stops accepting new jobs. Jobs which haven't been started yet are handed
+// to the pending function right away, without waiting for the running job
+// of their worker. Blocks until all running jobs are done.
+func (p *workerPool) Close() {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.quit)
+		for _, queue := range p.queues {
+			p.drain(queue)
+			close(queue)
+		}
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+// Hands all jobs waiting in the queue to the pending function.
+func (p *workerPool) drain(queue chan job) {
+	for {
+		select {
+		case j := <-queue:
+			p.pending(j.Body)
+		default:
+			return
+		}
+	}
+}
+
+// Locks per item, so notifications for the same item are never processed
+// concurrently, whether they come from the worker pool, the retry queue or
+// the reprocess endpoint.
+type itemLocks struct {
+	mu    *sync.Mutex
+	locks map[string]*itemLock
+}
+
+type itemLock struct {
+	mu *sync.Mutex
+	// Number of callers holding or waiting for the lock.
+	refs int
+}
+
+func newItemLocks() *itemLocks {
+	return &itemLocks{
+		mu:    &sync.Mutex{},
+		locks: make(map[string]*itemLock),
+	}
+}
+
+// Blocks until the item is locked and returns the function to unlock it.
+// Without locks (nil) nothing is locked.
+func (l *itemLocks) Lock(id string) func() {
+	if l == nil {
+		return func() {}
+	}
+	l.mu.Lock()
+	lock, ok := l.locks[id]
+	if !ok {
+		lock = &itemLock{mu: &sync.Mutex{}}
+		l.locks[id] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+		l.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(l.locks, id)
+		}
+		l.mu.Unlock()
+	}
+}
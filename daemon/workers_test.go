@@ -0,0 +1,90 @@
+package daemon
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestItemLocks(t *testing.T) {
+	locks := newItemLocks()
+	var mu sync.Mutex
+	running := map[string]int{}
+	maxRunning := map[string]int{}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		for _, id := range []string{"1", "2"} {
+			wg.Add(1)
+			go func(id string) {
+				defer wg.Done()
+				unlock := locks.Lock(id)
+				defer unlock()
+				mu.Lock()
+				running[id]++
+				if running[id] > maxRunning[id] {
+					maxRunning[id] = running[id]
+				}
+				mu.Unlock()
+				time.Sleep(time.Millisecond)
+				mu.Lock()
+				running[id]--
+				mu.Unlock()
+			}(id)
+		}
+	}
+	wg.Wait()
+	for id, n := range maxRunning {
+		if n != 1 {
+			t.Errorf("item %s was processed %d times concurrently", id, n)
+		}
+	}
+	if len(locks.locks) != 0 {
+		t.Errorf("%d locks left after unlocking", len(locks.locks))
+	}
+}
+
+func TestWorkerPoolCloseHandsQueuedJobsToPending(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var pending []string
+	pool := newWorkerPool(1, 4, func(body []byte) {
+		if string(body) == "running" {
+			close(started)
+			<-release
+		}
+	}, func(body []byte) {
+		mu.Lock()
+		pending = append(pending, string(body))
+		mu.Unlock()
+	})
+	pool.Submit(job{Key: "1", Body: []byte("running")})
+	<-started
+	pool.Submit(job{Key: "2", Body: []byte("queued 1")})
+	pool.Submit(job{Key: "3", Body: []byte("queued 2")})
+	closed := make(chan struct{})
+	go func() {
+		pool.Close()
+		close(closed)
+	}()
+	// The queued jobs are postponed while the running job still blocks.
+	deadline := time.After(time.Second)
+	for {
+		mu.Lock()
+		n := len(pending)
+		mu.Unlock()
+		if n == 2 {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("%d pending jobs while a job is running, want 2", n)
+		case <-time.After(time.Millisecond):
+		}
+	}
+	if pool.Submit(job{Key: "4", Body: []byte("late")}) {
+		t.Error("closed pool accepted a job")
+	}
+	close(release)
+	<-closed
+}
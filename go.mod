@@ -5,7 +5,6 @@ go 1.19
 require (
 	github.com/alex-berlin-tv/nexx_omnia_go v0.1.14
 	github.com/go-chi/chi/v5 v5.0.7
-	github.com/lithammer/fuzzysearch v1.1.5
 	github.com/markusmobius/go-dateparser v0.0.0-20220211203457-60965b2d2bfb
 	github.com/sirupsen/logrus v1.9.0
 	github.com/urfave/cli/v2 v2.23.5
@@ -20,6 +19,6 @@ require (
 	github.com/pasztorpisti/qs v0.0.0-20171216220353-8d6c33ee906c // indirect
 	github.com/russross/blackfriday/v2 v2.1.0 // indirect
 	github.com/xrash/smetrics v0.0.0-20201216005158-039620a65673 // indirect
-	golang.org/x/sys v0.0.0-20220722155257-8c9f86f7a55f // indirect
-	golang.org/x/text v0.15.0  // indirect
+	golang.org/x/sys v0.5.0 // indirect
+	golang.org/x/text v0.15.0 // indirect
 )
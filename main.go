@@ -1,12 +1,17 @@
 package main
 
 import (
+	"fmt"
 	"os"
+	"time"
 
+	"github.com/alex-berlin-tv/nexx_omnia_go/notification"
+	"github.com/alex-berlin-tv/nexx_omnia_go/omnia"
 	"github.com/alex-berlin-tv/radio-ingest/config"
 	"github.com/alex-berlin-tv/radio-ingest/daemon"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
+	"go.etcd.io/bbolt"
 )
 
 func main() {
@@ -19,6 +24,16 @@ func main() {
 		Aliases: []string{"d"},
 		Usage:   "enable debug mode",
 	}
+	dryRunFlag := cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "print intended Omnia changes and messages instead of applying them",
+	}
+	configFlag := cli.PathFlag{
+		Name:     "config",
+		Aliases:  []string{"c"},
+		Usage:    "path to config file",
+		Required: true,
+	}
 	app := &cli.App{
 		Name:  "radio-ingest",
 		Usage: "handles incoming radio uploads",
@@ -57,6 +72,25 @@ func main() {
 					},
 				},
 			},
+			{
+				Name:   "reprocess",
+				Usage:  "runs all tasks again for an already processed item",
+				Action: reprocessCmd,
+				Flags: []cli.Flag{
+					&traceFlag,
+					&debugFlag,
+					&cli.PathFlag{
+						Name:    "config",
+						Aliases: []string{"c"},
+						Usage:   "path to config file",
+					},
+					&cli.IntFlag{
+						Name:     "id",
+						Usage:    "ID of the audio item",
+						Required: true,
+					},
+				},
+			},
 			{
 				Name:   "run",
 				Usage:  "runs the daemon",
@@ -64,6 +98,7 @@ func main() {
 				Flags: []cli.Flag{
 					&traceFlag,
 					&debugFlag,
+					&dryRunFlag,
 					&cli.PathFlag{
 						Name:    "config",
 						Aliases: []string{"c"},
@@ -71,6 +106,76 @@ func main() {
 					},
 				},
 			},
+			{
+				Name:  "alias",
+				Usage: "manages aliases mapping show names entered by producers to shows",
+				Subcommands: []*cli.Command{
+					{
+						Name:   "add",
+						Usage:  "adds or replaces an alias",
+						Action: aliasAddCmd,
+						Flags: []cli.Flag{
+							&configFlag,
+							&cli.StringFlag{
+								Name:     "name",
+								Usage:    "show name as entered by producers",
+								Required: true,
+							},
+							&cli.IntFlag{
+								Name:     "show",
+								Usage:    "ID of the show in Omnia",
+								Required: true,
+							},
+						},
+					},
+					{
+						Name:   "list",
+						Usage:  "lists all aliases",
+						Action: aliasListCmd,
+						Flags:  []cli.Flag{&configFlag},
+					},
+					{
+						Name:   "remove",
+						Usage:  "removes an alias",
+						Action: aliasRemoveCmd,
+						Flags: []cli.Flag{
+							&configFlag,
+							&cli.StringFlag{
+								Name:     "name",
+								Usage:    "show name of the alias",
+								Required: true,
+							},
+						},
+					},
+				},
+			},
+			{
+				Name:   "render-message",
+				Usage:  "previews the message template with a recorded notification",
+				Action: renderMessageCmd,
+				Flags: []cli.Flag{
+					&cli.PathFlag{
+						Name:    "config",
+						Aliases: []string{"c"},
+						Usage:   "path to config file, defaults are used if omitted",
+					},
+					&cli.PathFlag{
+						Name:     "input",
+						Aliases:  []string{"i"},
+						Usage:    "recorded notification body from a JSON file",
+						Required: true,
+					},
+					&cli.PathFlag{
+						Name:    "template",
+						Aliases: []string{"t"},
+						Usage:   "template file, overrides the report template of the config",
+					},
+					&cli.StringFlag{
+						Name:  "locale",
+						Usage: "locale of the message, overrides the config",
+					},
+				},
+			},
 			{
 				Name:   "test-run",
 				Usage:  "test run command with an existing notification",
@@ -78,6 +183,7 @@ func main() {
 				Flags: []cli.Flag{
 					&traceFlag,
 					&debugFlag,
+					&dryRunFlag,
 					&cli.PathFlag{
 						Name:    "config",
 						Aliases: []string{"c"},
@@ -111,8 +217,24 @@ func recordCmd(ctx *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	dmn.Record(ctx.Path("output"))
-	return nil
+	return dmn.Record(ctx.Path("output"))
+}
+
+func reprocessCmd(ctx *cli.Context) error {
+	if ctx.Bool("trace") {
+		logrus.SetLevel(logrus.TraceLevel)
+	} else if ctx.Bool("debug") {
+		logrus.SetLevel(logrus.DebugLevel)
+	}
+	cfg, err := config.ConfigFromJSON(ctx.Path("config"))
+	if err != nil {
+		return err
+	}
+	dmn, err := daemon.NewDaemon(*cfg)
+	if err != nil {
+		return err
+	}
+	return dmn.Reprocess(ctx.Int("id"))
 }
 
 func runCmd(ctx *cli.Context) error {
@@ -129,8 +251,8 @@ func runCmd(ctx *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	dmn.Run()
-	return nil
+	dmn.DryRun = ctx.Bool("dry-run")
+	return dmn.Run()
 }
 
 func testRunCmd(ctx *cli.Context) error {
@@ -147,5 +269,92 @@ func testRunCmd(ctx *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	dmn.DryRun = ctx.Bool("dry-run")
 	return dmn.TestRun(ctx.Path("input"))
 }
+
+func renderMessageCmd(ctx *cli.Context) error {
+	cfg := config.ConfigFromDefaults()
+	if ctx.Path("config") != "" {
+		tmp, err := config.ConfigFromJSON(ctx.Path("config"))
+		if err != nil {
+			return err
+		}
+		cfg = *tmp
+	}
+	if ctx.Path("template") != "" {
+		cfg.Templates.Report = ctx.Path("template")
+	}
+	if ctx.String("locale") != "" {
+		cfg.Locale = ctx.String("locale")
+	}
+	messages, err := daemon.NewMessages(cfg.Locale, cfg.Templates)
+	if err != nil {
+		return err
+	}
+	dt, err := os.ReadFile(ctx.Path("input"))
+	if err != nil {
+		return err
+	}
+	ntf, err := notification.NotificationFromJson(dt)
+	if err != nil {
+		return err
+	}
+	msg, err := messages.PreviewReport(*ntf)
+	if err != nil {
+		return err
+	}
+	fmt.Print(msg)
+	return nil
+}
+
+// Opens the DB given in the config. The daemon holds a lock on the DB, so
+// the alias commands only work while it's stopped. Use the alias endpoints
+// of the daemon otherwise.
+func openDB(ctx *cli.Context) (*config.Config, *bbolt.DB, error) {
+	cfg, err := config.ConfigFromJSON(ctx.Path("config"))
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := daemon.OpenDB(cfg.DBPath)
+	return cfg, db, err
+}
+
+func aliasAddCmd(ctx *cli.Context) error {
+	cfg, db, err := openDB(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	omniaClt := omnia.NewOmnia(cfg.DomainId, cfg.ApiSecret, cfg.SessionId)
+	catalog, err := daemon.NewShowCatalog(omniaClt, db, time.Duration(cfg.ShowRefreshInterval)*time.Second)
+	if err != nil {
+		return err
+	}
+	return daemon.AddAlias(db, catalog, ctx.String("name"), ctx.Int("show"))
+}
+
+func aliasListCmd(ctx *cli.Context) error {
+	_, db, err := openDB(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	aliases, err := daemon.ListAliases(db)
+	if err != nil {
+		return err
+	}
+	for _, alias := range aliases {
+		fmt.Printf("%s\t%d\n", alias.Alias, alias.ShowID)
+	}
+	return nil
+}
+
+func aliasRemoveCmd(ctx *cli.Context) error {
+	_, db, err := openDB(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return daemon.RemoveAlias(db, ctx.String("name"))
+}
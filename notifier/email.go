@@ -0,0 +1,56 @@
+package notifier
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Sends messages as plain text mails via SMTP.
+type Email struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	To       []string
+	Subject  string
+}
+
+// Returns a new instance of [Email].
+func NewEmail(host string, port int, username string, password string, from string, to []string, subject string) Email {
+	return Email{
+		Host:     host,
+		Port:     port,
+		Username: username,
+		Password: password,
+		From:     from,
+		To:       to,
+		Subject:  subject,
+	}
+}
+
+// Send a message to all recipients. Authenticates with PLAIN if a username
+// is given.
+func (e Email) Send(msg string) error {
+	if len(e.To) == 0 {
+		return fmt.Errorf("no recipients configured")
+	}
+	var auth smtp.Auth
+	if e.Username != "" {
+		auth = smtp.PlainAuth("", e.Username, e.Password, e.Host)
+	}
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "From: %s\r\n", e.From)
+	fmt.Fprintf(&body, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&body, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", e.Subject))
+	fmt.Fprintf(&body, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	body.WriteString("MIME-Version: 1.0\r\n")
+	body.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	body.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	body.WriteString(strings.ReplaceAll(msg, "\n", "\r\n"))
+	return smtp.SendMail(fmt.Sprintf("%s:%d", e.Host, e.Port), auth, e.From, e.To, body.Bytes())
+}
@@ -0,0 +1,42 @@
+package notifier
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// A Matrix room. Messages are sent with the client-server API using the
+// access token of a bot account which has joined the room.
+type Matrix struct {
+	// Base URL of the homeserver, e.g. https://matrix.example.org.
+	Homeserver  string
+	RoomID      string
+	AccessToken string
+}
+
+// Returns a new instance of [Matrix].
+func NewMatrix(homeserver string, roomID string, accessToken string) Matrix {
+	return Matrix{
+		Homeserver:  strings.TrimSuffix(homeserver, "/"),
+		RoomID:      roomID,
+		AccessToken: accessToken,
+	}
+}
+
+// Send a message to the room.
+func (m Matrix) Send(msg string) error {
+	txnID := fmt.Sprintf("radio-ingest-%d", time.Now().UnixNano())
+	reqURL := fmt.Sprintf(
+		"%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		m.Homeserver, url.PathEscape(m.RoomID), txnID,
+	)
+	header := http.Header{}
+	header.Set("Authorization", fmt.Sprintf("Bearer %s", m.AccessToken))
+	return sendJSON(http.MethodPut, reqURL, header, map[string]string{
+		"msgtype": "m.text",
+		"body":    msg,
+	})
+}
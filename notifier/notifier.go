@@ -0,0 +1,174 @@
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alex-berlin-tv/radio-ingest/config"
+	"github.com/alex-berlin-tv/radio-ingest/stackfield"
+)
+
+// Sends messages to a chat room, channel or mailbox.
+type Notifier interface {
+	Send(msg string) error
+}
+
+// Returns a new [Notifier] as described by the config.
+func FromConfig(cfg config.NotifierConfig) (Notifier, error) {
+	switch cfg.Type {
+	case "stackfield":
+		if cfg.Stackfield.MaxLength != 0 && cfg.Stackfield.MaxLength < stackfield.MinMaxLength {
+			return nil, fmt.Errorf("max_length of stackfield notifier has to be at least %d", stackfield.MinMaxLength)
+		}
+		return stackfield.NewRoomWithOptions(cfg.URL, stackfieldOptions(cfg.Stackfield)), nil
+	case "slack":
+		return NewSlack(cfg.URL), nil
+	case "mattermost":
+		return NewMattermost(cfg.URL), nil
+	case "teams":
+		return NewTeams(cfg.URL), nil
+	case "matrix":
+		return NewMatrix(cfg.Homeserver, cfg.RoomID, cfg.AccessToken), nil
+	case "email":
+		return NewEmail(cfg.SMTPHost, cfg.SMTPPort, cfg.Username, cfg.Password, cfg.From, cfg.To, cfg.Subject), nil
+	}
+	return nil, fmt.Errorf("unknown notifier type '%s'", cfg.Type)
+}
+
+// Applies the configured values to the default options of a Stackfield room.
+func stackfieldOptions(cfg config.StackfieldConfig) stackfield.Options {
+	rsl := stackfield.DefaultOptions()
+	if cfg.Timeout > 0 {
+		rsl.Timeout = time.Duration(cfg.Timeout) * time.Second
+	}
+	if cfg.RetryMaxAttempts > 0 {
+		rsl.MaxAttempts = cfg.RetryMaxAttempts
+	}
+	if cfg.RetryBaseDelay > 0 {
+		rsl.BaseDelay = time.Duration(cfg.RetryBaseDelay) * time.Second
+	}
+	if cfg.RateLimit > 0 {
+		rsl.MinInterval = time.Minute / time.Duration(cfg.RateLimit)
+	}
+	if cfg.MaxLength > 0 {
+		rsl.MaxLength = cfg.MaxLength
+	}
+	return rsl
+}
+
+// Implemented by notifiers which split long messages into parts. Allows to
+// continue an interrupted delivery without sending the delivered parts again.
+type PartSender interface {
+	// Sends the parts of the message starting with the given index. Returns
+	// the number of parts delivered so far.
+	SendParts(msg string, from int) (int, error)
+}
+
+// Marks a notifier in a [Delivery] which received the whole message.
+const Delivered = -1
+
+// Progress of the delivery of a message to multiple notifiers. Maps the name
+// of a notifier to the number of delivered parts or to [Delivered].
+type Delivery map[string]int
+
+// States whether all given notifiers received the whole message.
+func (d Delivery) Complete(names []string) bool {
+	for _, name := range names {
+		if d[name] != Delivered {
+			return false
+		}
+	}
+	return true
+}
+
+// A notifier with the name it's referred to in the config.
+type Named struct {
+	Name     string
+	Notifier Notifier
+}
+
+// Sends messages to multiple notifiers.
+type Multi []Named
+
+// Returns the names of the notifiers.
+func (m Multi) Names() []string {
+	var rsl []string
+	for _, ntf := range m {
+		rsl = append(rsl, ntf.Name)
+	}
+	return rsl
+}
+
+// Sends the message to all notifiers. A failing notifier doesn't prevent the
+// others from receiving the message, the errors of all failed notifiers are
+// combined.
+func (m Multi) Send(msg string) error {
+	return m.Deliver(msg, Delivery{})
+}
+
+// Sends the message to all notifiers which didn't receive it according to
+// the delivery and records the progress in it. Notifiers splitting the
+// message continue with the first part which wasn't delivered.
+func (m Multi) Deliver(msg string, delivery Delivery) error {
+	var errs []string
+	for _, ntf := range m {
+		sent := delivery[ntf.Name]
+		if sent == Delivered {
+			continue
+		}
+		var err error
+		if parts, ok := ntf.Notifier.(PartSender); ok {
+			sent, err = parts.SendParts(msg, sent)
+			delivery[ntf.Name] = sent
+		} else {
+			err = ntf.Notifier.Send(msg)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", ntf.Name, err))
+			continue
+		}
+		delivery[ntf.Name] = Delivered
+	}
+	if len(errs) != 0 {
+		return fmt.Errorf("failed to send message, %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+var httpClient = &http.Client{
+	Timeout: time.Second * 10,
+}
+
+// Sends the payload as JSON to the given URL. Fails if the response status
+// isn't 2xx.
+func sendJSON(method string, url string, header http.Header, payload any) error {
+	dt, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(dt))
+	if err != nil {
+		return err
+	}
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	rsp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(rsp.Body, 512))
+		return fmt.Errorf("got status %d, %s", rsp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
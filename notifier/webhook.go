@@ -0,0 +1,48 @@
+package notifier
+
+import "net/http"
+
+// A Slack channel reached by an incoming webhook.
+type Slack struct {
+	URL string
+}
+
+// Returns a new instance of [Slack].
+func NewSlack(url string) Slack {
+	return Slack{URL: url}
+}
+
+// Send a message to the channel.
+func (s Slack) Send(msg string) error {
+	return sendJSON(http.MethodPost, s.URL, nil, map[string]string{"text": msg})
+}
+
+// A Mattermost channel reached by an incoming webhook.
+type Mattermost struct {
+	URL string
+}
+
+// Returns a new instance of [Mattermost].
+func NewMattermost(url string) Mattermost {
+	return Mattermost{URL: url}
+}
+
+// Send a message to the channel.
+func (m Mattermost) Send(msg string) error {
+	return sendJSON(http.MethodPost, m.URL, nil, map[string]string{"text": msg})
+}
+
+// A Microsoft Teams channel reached by an incoming webhook.
+type Teams struct {
+	URL string
+}
+
+// Returns a new instance of [Teams].
+func NewTeams(url string) Teams {
+	return Teams{URL: url}
+}
+
+// Send a message to the channel.
+func (t Teams) Send(msg string) error {
+	return sendJSON(http.MethodPost, t.URL, nil, map[string]string{"text": msg})
+}
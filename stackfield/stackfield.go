@@ -6,7 +6,11 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 )
 
 // Stackfield call response.
@@ -15,52 +19,247 @@ type Response struct {
 	ErrorText string
 }
 
+// Behavior of a [Room] on failures and long messages.
+type Options struct {
+	// Timeout of a single request.
+	Timeout time.Duration
+	// Maximum number of attempts for a message part. Network errors, 5xx
+	// and 429 responses are retried.
+	MaxAttempts int
+	// Delay before the first retry. Doubles with each attempt.
+	BaseDelay time.Duration
+	// Minimal time between two requests to the room. No limit if zero.
+	MinInterval time.Duration
+	// Messages longer than this number of characters are split into
+	// multiple parts. No splitting if zero.
+	MaxLength int
+}
+
+// Returns the default [Options].
+func DefaultOptions() Options {
+	return Options{
+		Timeout:     5 * time.Second,
+		MaxAttempts: 3,
+		BaseDelay:   2 * time.Second,
+		MinInterval: time.Second,
+		MaxLength:   4000,
+	}
+}
+
 // A Stackfield room to which messages can be sent.
 type Room struct {
-	URL string
+	URL     string
+	Options Options
+	client  *http.Client
+	limiter *rateLimiter
 }
 
-// Returns a new instance of [Room].
+// Returns a new instance of [Room] using the default options.
 func NewRoom(url string) Room {
+	return NewRoomWithOptions(url, DefaultOptions())
+}
+
+// Returns a new instance of [Room] with the given options.
+func NewRoomWithOptions(url string, opts Options) Room {
 	return Room{
-		URL: url,
+		URL:     url,
+		Options: opts,
+		client:  &http.Client{Timeout: opts.Timeout},
+		limiter: &rateLimiter{interval: opts.MinInterval},
 	}
 }
 
-// Send a message to the room.
+// Characters reserved for the counter prepended to the parts of a split
+// message.
+const partCounterLen = 16
+
+// Smallest maximum message length, leaves room for the part counter.
+const MinMaxLength = partCounterLen + 1
+
+// Upper bound for the delay requested by Stackfield with Retry-After, so a
+// misbehaving server can't block the sender.
+const maxRetryAfter = time.Minute
+
+// Send a message to the room. Messages exceeding the maximum length are sent
+// in multiple parts.
 func (r Room) Send(msg string) error {
-	var bodyDt = make(map[string]string)
-	bodyDt["Title"] = msg
-	bodyBt, err := json.Marshal(bodyDt)
+	_, err := r.SendParts(msg, 0)
+	return err
+}
+
+// Sends the parts of the message starting with the given index. Returns the
+// number of delivered parts, so an interrupted delivery can be continued.
+func (r Room) SendParts(msg string, from int) (int, error) {
+	parts := splitMessage(msg, r.Options.MaxLength)
+	if len(parts) > 1 {
+		// Leaves room for the part counter.
+		parts = splitMessage(msg, r.Options.MaxLength-partCounterLen)
+	}
+	for i := from; i < len(parts); i++ {
+		part := parts[i]
+		if len(parts) > 1 {
+			part = fmt.Sprintf("(%d/%d)\n%s", i+1, len(parts), part)
+		}
+		if err := r.sendWithRetry(part); err != nil {
+			if len(parts) > 1 {
+				return i, fmt.Errorf("failed to send part %d of %d, %s", i+1, len(parts), err)
+			}
+			return i, err
+		}
+	}
+	return len(parts), nil
+}
+
+// Sends a single message, retrying temporary failures with exponential
+// backoff.
+func (r Room) sendWithRetry(msg string) error {
+	var err error
+	attempts := r.Options.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	for attempt := 1; attempt <= attempts; attempt++ {
+		var delay time.Duration
+		delay, err = r.send(msg)
+		if err == nil {
+			return nil
+		}
+		if delay < 0 || attempt == attempts {
+			break
+		}
+		if delay == 0 {
+			delay = r.Options.BaseDelay * time.Duration(1<<(attempt-1))
+		}
+		time.Sleep(delay)
+	}
+	return err
+}
+
+// Sends a single request. On failure the returned delay states whether the
+// request can be retried: negative if not, zero to use the backoff or the
+// delay requested by Stackfield.
+func (r Room) send(msg string) (time.Duration, error) {
+	bodyBt, err := json.Marshal(map[string]string{"Title": msg})
 	if err != nil {
-		return err
+		return -1, err
 	}
-	bodyRd := bytes.NewReader(bodyBt)
-	req, err := http.NewRequest(http.MethodPost, r.URL, bodyRd)
+	req, err := http.NewRequest(http.MethodPost, r.URL, bytes.NewReader(bodyBt))
 	if err != nil {
-		return err
+		return -1, err
 	}
 	req.Header.Add("Content-Type", "application/json")
-	clt := http.Client{
-		Timeout: time.Second * 5,
+	r.limiter.wait()
+	clt := r.client
+	if clt == nil {
+		clt = &http.Client{Timeout: r.Options.Timeout}
 	}
 	rsp, err := clt.Do(req)
 	if err != nil {
-		return err
+		return 0, err
 	}
-
 	defer rsp.Body.Close()
 	rspBt, err := io.ReadAll(rsp.Body)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	if rsp.StatusCode == http.StatusTooManyRequests || rsp.StatusCode >= 500 {
+		return retryAfter(rsp), fmt.Errorf("got status %d from Stackfield, %s", rsp.StatusCode, snippet(rspBt))
 	}
 	var stkRsp Response
 	if err := json.Unmarshal(rspBt, &stkRsp); err != nil {
-		return err
+		return -1, fmt.Errorf("got invalid response with status %d from Stackfield, %s", rsp.StatusCode, snippet(rspBt))
 	}
 	if stkRsp.Result != "ok" {
-		return fmt.Errorf("got error code %s while calling Stackfield, %s", stkRsp.Result, stkRsp.ErrorText)
+		return -1, fmt.Errorf("got error code %s while calling Stackfield, %s", stkRsp.Result, stkRsp.ErrorText)
+	}
+	return 0, nil
+}
+
+// Returns the delay requested by the Retry-After header in seconds, zero if
+// absent. The delay is capped at [maxRetryAfter].
+func retryAfter(rsp *http.Response) time.Duration {
+	secs, err := strconv.Atoi(rsp.Header.Get("Retry-After"))
+	if err != nil || secs < 0 {
+		return 0
+	}
+	rsl := time.Duration(secs) * time.Second
+	if rsl > maxRetryAfter || rsl < 0 {
+		return maxRetryAfter
+	}
+	return rsl
+}
+
+// Returns the beginning of a response body for error messages.
+func snippet(body []byte) string {
+	const maxLen = 200
+	rsl := strings.TrimSpace(string(body))
+	if len(rsl) > maxLen {
+		rsl = strings.ToValidUTF8(rsl[:maxLen], "") + "..."
+	}
+	if rsl == "" {
+		return "empty body"
 	}
+	return rsl
+}
+
+// Splits the message into parts of at most maxLen characters. Splits at line
+// breaks where possible, lines exceeding the limit on their own are cut. The
+// line breaks between two parts are dropped.
+func splitMessage(msg string, maxLen int) []string {
+	if maxLen <= 0 || utf8.RuneCountInString(msg) <= maxLen {
+		return []string{msg}
+	}
+	var rsl []string
+	var current strings.Builder
+	currentLen := 0
+	flush := func() {
+		if part := strings.Trim(current.String(), "\n"); part != "" {
+			rsl = append(rsl, part)
+		}
+		current.Reset()
+		currentLen = 0
+	}
+	for _, line := range strings.SplitAfter(msg, "\n") {
+		// The trailing line break doesn't count, it's dropped at the end
+		// of a part.
+		content := strings.TrimSuffix(line, "\n")
+		for utf8.RuneCountInString(content) > maxLen {
+			flush()
+			runes := []rune(content)
+			rsl = append(rsl, string(runes[:maxLen]))
+			content = string(runes[maxLen:])
+			line = strings.TrimPrefix(line, string(runes[:maxLen]))
+		}
+		if currentLen+utf8.RuneCountInString(content) > maxLen {
+			flush()
+		}
+		current.WriteString(line)
+		currentLen += utf8.RuneCountInString(line)
+	}
+	flush()
+	return rsl
+}
+
+// Ensures a minimal interval between requests. Shared by all copies of a
+// [Room].
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
 
-	return nil
+// Blocks until the next request is allowed.
+func (l *rateLimiter) wait() {
+	if l == nil || l.interval <= 0 {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	slot := l.next
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next = slot.Add(l.interval)
+	l.mu.Unlock()
+	time.Sleep(time.Until(slot))
 }
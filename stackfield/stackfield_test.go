@@ -0,0 +1,317 @@
+package stackfield
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		name   string
+		msg    string
+		maxLen int
+		want   []string
+	}{
+		{
+			name:   "no limit",
+			msg:    "abc\ndef",
+			maxLen: 0,
+			want:   []string{"abc\ndef"},
+		},
+		{
+			name:   "fits exactly",
+			msg:    "abc\ndef",
+			maxLen: 7,
+			want:   []string{"abc\ndef"},
+		},
+		{
+			name:   "split at line break",
+			msg:    "abc\ndef\nghi",
+			maxLen: 8,
+			want:   []string{"abc\ndef", "ghi"},
+		},
+		{
+			name:   "long single line",
+			msg:    "abcdefghij",
+			maxLen: 4,
+			want:   []string{"abcd", "efgh", "ij"},
+		},
+		{
+			name:   "long line followed by others",
+			msg:    "ab\ncdefghij\nkl",
+			maxLen: 4,
+			want:   []string{"ab", "cdef", "ghij", "kl"},
+		},
+		{
+			name:   "line of exactly the limit",
+			msg:    "abcd\nefgh\nij",
+			maxLen: 4,
+			want:   []string{"abcd", "efgh", "ij"},
+		},
+		{
+			name:   "line of a multiple of the limit",
+			msg:    "abcdefgh\nij",
+			maxLen: 4,
+			want:   []string{"abcd", "efgh", "ij"},
+		},
+		{
+			name:   "multi-byte runes",
+			msg:    "äöüß€\nñ",
+			maxLen: 3,
+			want:   []string{"äöü", "ß€", "ñ"},
+		},
+		{
+			name:   "multi-byte runes fitting",
+			msg:    "äöü\n€",
+			maxLen: 5,
+			want:   []string{"äöü\n€"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitMessage(tt.msg, tt.maxLen)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			for _, part := range got {
+				if !utf8.ValidString(part) {
+					t.Errorf("part %q is no valid UTF-8", part)
+				}
+				if tt.maxLen > 0 && utf8.RuneCountInString(part) > tt.maxLen {
+					t.Errorf("part %q exceeds %d characters", part, tt.maxLen)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", 0},
+		{"soon", 0},
+		{"Wed, 21 Oct 2026 07:28:00 GMT", 0},
+		{"-5", 0},
+		{"0", 0},
+		{"30", 30 * time.Second},
+		{"60", time.Minute},
+		{"3600", maxRetryAfter},
+		{"99999999999", maxRetryAfter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			rsp := &http.Response{Header: http.Header{}}
+			if tt.header != "" {
+				rsp.Header.Set("Retry-After", tt.header)
+			}
+			if got := retryAfter(rsp); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// Answer of the test server.
+type testAnswer struct {
+	status int
+	body   string
+}
+
+var answerOk = testAnswer{http.StatusOK, `{"Result": "ok"}`}
+
+// Stackfield test server. Answers the requests in order, the last answer
+// is repeated.
+type testServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	answers []testAnswer
+	titles  []string
+}
+
+func newTestServer(t *testing.T, answers ...testAnswer) *testServer {
+	srv := &testServer{answers: answers}
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("invalid request body, %s", err)
+		}
+		srv.mu.Lock()
+		srv.titles = append(srv.titles, body["Title"])
+		answer := srv.answers[0]
+		if len(srv.answers) > 1 {
+			srv.answers = srv.answers[1:]
+		}
+		srv.mu.Unlock()
+		w.WriteHeader(answer.status)
+		w.Write([]byte(answer.body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// Returns the titles of all received requests.
+func (s *testServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.titles...)
+}
+
+func testRoom(url string, maxLength int) Room {
+	return NewRoomWithOptions(url, Options{
+		Timeout:     time.Second,
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		MaxLength:   maxLength,
+	})
+}
+
+func TestSendRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		answers  []testAnswer
+		attempts int
+		fails    bool
+	}{
+		{
+			name:     "ok",
+			answers:  []testAnswer{answerOk},
+			attempts: 1,
+		},
+		{
+			name:     "server error retried",
+			answers:  []testAnswer{{http.StatusInternalServerError, `{"Result": "error"}`}},
+			attempts: 3,
+			fails:    true,
+		},
+		{
+			name:     "server error recovered",
+			answers:  []testAnswer{{http.StatusServiceUnavailable, ""}, answerOk},
+			attempts: 2,
+		},
+		{
+			name:     "non-JSON server error retried",
+			answers:  []testAnswer{{http.StatusBadGateway, "<html>Bad Gateway</html>"}},
+			attempts: 3,
+			fails:    true,
+		},
+		{
+			name:     "rate limit retried",
+			answers:  []testAnswer{{http.StatusTooManyRequests, ""}, {http.StatusTooManyRequests, ""}, answerOk},
+			attempts: 3,
+		},
+		{
+			name:     "client error not retried",
+			answers:  []testAnswer{{http.StatusBadRequest, `{"Result": "error", "ErrorText": "invalid"}`}},
+			attempts: 1,
+			fails:    true,
+		},
+		{
+			name:     "non-JSON response not retried",
+			answers:  []testAnswer{{http.StatusOK, "<html>Login</html>"}},
+			attempts: 1,
+			fails:    true,
+		},
+		{
+			name:     "error result not retried",
+			answers:  []testAnswer{{http.StatusOK, `{"Result": "error", "ErrorText": "unknown room"}`}},
+			attempts: 1,
+			fails:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, tt.answers...)
+			err := testRoom(srv.URL, 0).Send("hello")
+			if (err != nil) != tt.fails {
+				t.Errorf("got error %v, want failure %t", err, tt.fails)
+			}
+			if n := len(srv.received()); n != tt.attempts {
+				t.Errorf("%d attempts, want %d", n, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestSendPartsCounter(t *testing.T) {
+	srv := newTestServer(t, answerOk)
+	room := testRoom(srv.URL, MinMaxLength+2)
+	sent, err := room.SendParts(strings.Repeat("ä", 30), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	titles := srv.received()
+	if sent != 10 || len(titles) != 10 {
+		t.Fatalf("reported %d parts, sent %d, want 10", sent, len(titles))
+	}
+	if titles[0] != "(1/10)\näää" || titles[9] != "(10/10)\näää" {
+		t.Errorf("sent %q, want counted parts of 3 characters", titles)
+	}
+	for _, title := range titles {
+		if utf8.RuneCountInString(title) > room.Options.MaxLength {
+			t.Errorf("part %q exceeds %d characters", title, room.Options.MaxLength)
+		}
+	}
+}
+
+func TestSendPartsResume(t *testing.T) {
+	msg := "first part\nsecond prt\nthird part"
+	tests := []struct {
+		name    string
+		from    int
+		answers []testAnswer
+		sent    int
+		fails   bool
+		titles  []string
+	}{
+		{
+			name:    "all parts",
+			answers: []testAnswer{answerOk},
+			sent:    3,
+			titles:  []string{"(1/3)\nfirst part", "(2/3)\nsecond prt", "(3/3)\nthird part"},
+		},
+		{
+			name:    "interrupted",
+			answers: []testAnswer{answerOk, {http.StatusBadRequest, `{"Result": "error"}`}},
+			sent:    1,
+			fails:   true,
+			titles:  []string{"(1/3)\nfirst part", "(2/3)\nsecond prt"},
+		},
+		{
+			name:    "resumed",
+			from:    1,
+			answers: []testAnswer{answerOk},
+			sent:    3,
+			titles:  []string{"(2/3)\nsecond prt", "(3/3)\nthird part"},
+		},
+		{
+			name:    "already delivered",
+			from:    3,
+			answers: []testAnswer{answerOk},
+			sent:    3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, tt.answers...)
+			sent, err := testRoom(srv.URL, partCounterLen+10).SendParts(msg, tt.from)
+			if (err != nil) != tt.fails {
+				t.Errorf("got error %v, want failure %t", err, tt.fails)
+			}
+			if sent != tt.sent {
+				t.Errorf("reported %d delivered parts, want %d", sent, tt.sent)
+			}
+			titles := srv.received()
+			if strings.Join(titles, "|") != strings.Join(tt.titles, "|") {
+				t.Errorf("sent %q, want %q", titles, tt.titles)
+			}
+		})
+	}
+}